@@ -1,42 +1,116 @@
 package authz
 
 import (
-	"encoding/json"
+	"crypto/x509"
 	"fmt"
 	"github.com/Sirupsen/logrus"
 	logrus_syslog "github.com/Sirupsen/logrus/hooks/syslog"
 	"github.com/docker/docker/pkg/authorization"
-	"github.com/howeyc/fsnotify"
 	"github.com/twistlock/authz/core"
-	"io/ioutil"
 	"log/syslog"
 	"net/http"
-	"net/url"
 	"os"
 	"path"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // BasicPolicy represent a single policy object that is evaluated in the authorization flow.
-// Each policy object consists of multiple users and docker actions, where each user belongs to a single policy.
+// Each policy object consists of multiple users and docker actions.
 //
 // The policies are evaluated according to the following flow:
-//   For each policy object check
-//      If the user belongs to the policy
-//         If action in request in policy allow otherwise deny
-//   If no appropriate policy found, return deny
 //
-// Remark: In basic flow, each user must have a unique policy.
-// If a user is used by more than one policy, the results may be inconsistent
+//	For each policy object the user (or any of the user groups or client certificate attributes) belongs to
+//	   If action in request in policy deny actions, the policy denies the request
+//	   If request API version is deprecated by the policy, the policy denies the request
+//	   If action in request in policy (and satisfies the policy restrictions), the policy allows the request
+//	If any policy denies the request, return deny
+//	If any policy allows the request, return allow
+//	Otherwise return deny
+//
+// Only policies in enforce mode take part in the decision. If the decision is allow, but evaluating
+// the policies in monitor mode as well results in deny, the request is allowed with a would-deny message.
+//
+// Deny actions take precedence over actions (deny overrides), e.g., a policy with actions ["*"] and deny actions ["swarm_leave"]
+// allows every action except swarm_leave. A user can belong to multiple policies, in which case the allowed actions
+// are the union of the actions allowed by each policy, excluding the actions denied by any of them.
+//
+// Restrictions (e.g., Container, Volume, Network or Build) are default deny: once a policy specifies a restriction, the security
+// sensitive settings it covers (e.g., privileged mode, host namespaces or bind mounts) are denied unless the restriction explicitly
+// allows them. Settings covered by restrictions the policy does not specify are not restricted.
 type BasicPolicy struct {
 	Actions []string `json:"actions"` // Actions are the docker actions (mapped to authz terminology) that are allowed according to this policy
-	// Action are are specified as regular expressions
-	Users    []string `json:"users"`    // Users are the users for which this policy apply to
-	Name     string   `json:"name"`     // Name is the policy name
-	Readonly bool     `json:"readonly"` // Readonly indicates this policy only allow get commands
+	// Actions are exact actions (e.g., container_create), globs (e.g., container_*) or anchored regular expressions when prefixed with re:
+	// (e.g., re:container_(start|stop)). Patterns that do not match any action otherwise are deprecated unanchored regular expressions
+	DenyActions []string `json:"deny_actions"` // DenyActions are the docker actions that are denied according to this policy, regardless of Actions
+	// Deny actions are specified as action patterns as well
+	Users  []string `json:"users"`  // Users are the users for which this policy apply to
+	Groups []string `json:"groups"` // Groups are the user groups for which this policy apply to
+	// Principals are the client certificate attributes for which this policy apply to, keyed by field (e.g., uri, email, ou or issuer).
+	// Attribute values are matched against globs or regular expressions (when prefixed with re:)
+	Principals map[string][]string `json:"principals"`
+	// Issuers restricts the policy to client certificates issued by one of the given CA certificates, specified by SHA-256 fingerprint.
+	// Otherwise, any CA trusted by docker daemon can issue a client certificate with a user that belongs to the policy
+	Issuers []string `json:"issuers"`
+	// Mode is the policy enforcement mode, either enforce (default) or monitor.
+	// Monitor policies do not affect the decision, requests they would deny are allowed and audited as would-deny
+	Mode     string `json:"mode"`
+	Name     string `json:"name"`     // Name is the policy name
+	Readonly bool   `json:"readonly"` // Readonly indicates this policy only allow get commands
+	// MinAPIVersion restricts the policy to requests with API version equal to or greater than the given version (e.g., 1.40).
+	// Requests without API version are served in the daemon latest version and are not restricted
+	MinAPIVersion string `json:"min_api_version"`
+	// DeprecatedAPIVersion denies requests with API version equal to or lower than the given version (e.g., 1.23), regardless of other policies
+	DeprecatedAPIVersion string `json:"deprecated_api_version"`
+	// Resources restricts the policy to objects whose id or name (as it appears in the request URI) matches one of the given patterns.
+	// Patterns are grouped by resource kind (e.g., container, image, volume or network), kinds that are not specified are not restricted,
+	// and unsupported kinds are rejected when the policy is loaded.
+	// Patterns are globs (e.g., alice-*) or anchored regular expressions when prefixed with re: (e.g., re:alice-[0-9]+).
+	// References that can be object ids or id prefixes (e.g., db12 or sha256:db12) only match literal patterns, except for volumes,
+	// and the name of created containers (the name query parameter of container_create) must match the container patterns
+	Resources map[string][]string `json:"resources"`
+	// Container restricts the container configuration (e.g., privileged mode or bind mounts) that can be requested in container_create,
+	// and in the service task templates of service_create and service_update. If not specified, the container configuration is not restricted
+	Container *ContainerPolicy `json:"container"`
+	// Exec restricts the exec instances (e.g., privileged, root user or command) that can be created in container_exec_create.
+	// If not specified, exec instances are not restricted
+	Exec *ExecPolicy `json:"exec"`
+	// Volume restricts the volume drivers and local volume options (e.g., bind or device mounts) that can be used in volume_create,
+	// and in the volumes created by container_create and service task mounts. If not specified, volumes are not restricted
+	Volume *VolumePolicy `json:"volume"`
+	// Network restricts the network drivers, options and subnets that can be used in network_create.
+	// If not specified, networks are not restricted
+	Network *NetworkPolicy `json:"network"`
+	// Build restricts the build options (e.g., host network, remote context or build arguments) that can be requested in image_build.
+	// If not specified, builds are not restricted
+	Build *BuildPolicy `json:"build"`
+	// Image restricts the images that can be used in container_create, service_create, service_update, image_create, image_push, image_tag and image_build.
+	// If not specified, images are not restricted
+	Image *ImagePolicy `json:"image"`
+	// OwnerLabel restricts container_list responses to containers whose owner label (e.g., com.example.owner) is the request user,
+	// and requires created containers to be labeled accordingly
+	OwnerLabel string `json:"owner_label"`
+	// Owner restricts actions on existing containers (e.g., container_stop, container_exec_create or container_logs) to containers
+	// created by the request user (user), or by a user that shared a group with the request user when the container was created (group)
+	Owner string `json:"owner"`
+	// RevealSecrets allows container_inspect responses to reveal environment variables that match the secret patterns
+	RevealSecrets bool `json:"reveal_secrets"`
+
+	actionPatterns     []*actionPattern // actionPatterns are the compiled Actions, set when the policy is validated
+	denyActionPatterns []*actionPattern // denyActionPatterns are the compiled DenyActions, set when the policy is validated
+	// actions and denyActions map each docker action to the first action (or deny action) pattern that matches it (nil if none),
+	// set when the policy is indexed
+	actions     map[string]*actionPattern
+	denyActions map[string]*actionPattern
+
+	patternSet // patternSet holds the compiled policy patterns, set when the policy is validated
 }
 
+// regexPatternPrefix indicates a policy pattern is a regular expression rather than a glob
+const regexPatternPrefix = "re:"
+
 const (
 	// AuditHookSyslog indicates logs are streamed  to local syslog
 	AuditHookSyslog = "syslog"
@@ -52,13 +126,25 @@ const (
 const defaultAuditLogPath = "/var/log/authz-broker.log"
 
 type basicAuthorizer struct {
-	settings *BasicAuthorizerSettings
-	policies []BasicPolicy
+	settings  *BasicAuthorizerSettings
+	identity  *core.IdentityExtractor
+	issuerCAs []*x509.Certificate
+	owners    *ownershipStore
+	secrets   patternSet   // secrets holds the compiled secret patterns
+	policies  atomic.Value // policies holds the current *policySnapshot, replaced as a whole on reload
+	reload    sync.Mutex   // reload serializes policy reloads (file changes and SIGHUP)
 }
 
 // BasicAuthorizerSettings provides settings for the basic authoerizer flow
 type BasicAuthorizerSettings struct {
-	PolicyPath string // PolicyPath is the path to the policy settings
+	PolicyPath      string             // PolicyPath is the path to the policy file, or to a directory of policy files
+	GroupResolver   core.GroupResolver // GroupResolver resolves the groups of the request user (optional)
+	PrincipalFields []string           // PrincipalFields are the client certificate fields policies can match on (all fields if empty)
+	TrustedIssuers  []string           // TrustedIssuers are the SHA-256 fingerprints of the CA certificates that can issue client certificates (any CA if empty)
+	IssuerCAPath    string             // IssuerCAPath is the path to PEM encoded CA certificates that clients do not send in the chain, e.g., root CAs (optional)
+	OwnershipPath   string             // OwnershipPath is the path to the container ownership file (ownership is kept in memory if empty)
+	SecretPatterns  []string           // SecretPatterns are the environment variable (NAME=value) patterns considered secrets in container_inspect responses
+	EventAuditor    core.EventAuditor  // EventAuditor audits policy load failures (optional)
 }
 
 // NewBasicAuthZAuthorizer creates a new basic authorizer
@@ -69,139 +155,541 @@ func NewBasicAuthZAuthorizer(settings *BasicAuthorizerSettings) core.Authorizer
 // Init loads the basic authz plugin configuration from disk
 func (f *basicAuthorizer) Init() error {
 
-	err := f.loadPolicies()
+	if f.settings.IssuerCAPath != "" {
+		issuerCAs, err := core.LoadCertificates(f.settings.IssuerCAPath)
+		if err != nil {
+			return err
+		}
+		f.issuerCAs = issuerCAs
+	}
+
+	identity, err := core.NewIdentityExtractor(f.settings.PrincipalFields, f.issuerCAs)
 	if err != nil {
 		return err
 	}
+	f.identity = identity
 
-	watcher, err := fsnotify.NewWatcher()
+	f.secrets, err = compilePatterns(f.settings.SecretPatterns)
 	if err != nil {
 		return err
 	}
 
-	go func() {
-		for {
-			select {
-			case ev := <-watcher.Event:
-				if ev.IsModify() {
-					err := f.loadPolicies()
-					if err != nil {
-						logrus.Errorf("Error refreshing policy %q", err.Error())
-					}
-				}
-			case err := <-watcher.Error:
-				logrus.Errorf("Settings watcher error '%v'", err)
-			}
-		}
-	}()
+	f.owners = newOwnershipStore(f.settings.OwnershipPath)
+	if err := f.owners.load(); err != nil {
+		return err
+	}
 
-	err = watcher.Watch(f.settings.PolicyPath)
+	err = f.loadPolicies()
 	if err != nil {
-		// Silently ignore watching error
-		logrus.Errorf("Failed to start watching folder %q", err.Error())
+		return err
 	}
 
-	return nil
+	if f.settings.GroupResolver != nil {
+		if err := f.settings.GroupResolver.Init(); err != nil {
+			return err
+		}
+	}
+
+	reloadOnSignal(f.settings.PolicyPath, f.loadPolicies)
+	return watchFile(f.settings.PolicyPath, f.loadPolicies)
 }
 
+// loadPolicies loads the policy file (or policy directory), the current policies are kept if any of the policies is invalid.
+// The loaded policies are published as a new snapshot, so requests being evaluated keep using the previous policies
 func (f *basicAuthorizer) loadPolicies() error {
-	data, err := ioutil.ReadFile(path.Join(f.settings.PolicyPath))
+	f.reload.Lock()
+	defer f.reload.Unlock()
 
+	policies, err := loadPolicyPath(f.settings.PolicyPath)
+	if err == nil {
+		err = validatePolicies(policies)
+	}
 	if err != nil {
+		if f.settings.EventAuditor != nil {
+			auditErr := f.settings.EventAuditor.AuditEvent("Policy load failed", map[string]interface{}{
+				"policy_path":     f.settings.PolicyPath,
+				"err":             err.Error(),
+				"active_policies": len(f.snapshot().policies),
+			})
+			if auditErr != nil {
+				logrus.Errorf("Failed to audit policy load failure %q", auditErr.Error())
+			}
+		}
 		return err
 	}
+	logrus.Infof("Loaded '%d' policies", len(policies))
 
-	var policies []BasicPolicy
-	for _, l := range strings.Split(string(data), "\n") {
+	f.policies.Store(newPolicySnapshot(policies))
+	return nil
+}
 
-		if l == "" {
-			continue
-		}
+// snapshot returns the current policies (an empty snapshot if no policies were loaded)
+func (f *basicAuthorizer) snapshot() *policySnapshot {
+	if snapshot, ok := f.policies.Load().(*policySnapshot); ok {
+		return snapshot
+	}
+	return &policySnapshot{}
+}
 
-		var policy BasicPolicy
-		err := json.Unmarshal([]byte(l), &policy)
-		if err != nil {
-			logrus.Errorf("Failed to unmarshel policy entry %q %q", l, err.Error())
+func (f *basicAuthorizer) AuthZReq(authZReq *authorization.Request) *authorization.Response {
+
+	logrus.Debugf("Received AuthZ request, method: '%s', url: '%s'", authZReq.RequestMethod, authZReq.RequestURI)
+	route, err := core.ParseRequest(authZReq.RequestMethod, authZReq.RequestURI)
+	if err != nil {
+		return &authorization.Response{
+			Allow: false,
+			Msg:   fmt.Sprintf("invalid request URI: %s", err.Error()),
 		}
-		policies = append(policies, policy)
 	}
-	logrus.Infof("Loaded '%d' policies", len(policies))
+	action := route.Action
+	// Requests that are not mapped to any action (e.g., endpoints added in newer docker versions) cannot be restricted by policies
+	if action == core.ActionNone {
+		return &authorization.Response{
+			Allow: false,
+			Msg:   fmt.Sprintf("request '%s %s' is not mapped to any action", authZReq.RequestMethod, authZReq.RequestURI),
+		}
+	}
+
+	policies, groups, res := f.userPolicies(authZReq)
+	if res != nil {
+		return res
+	}
 
-	// Notify when user appears in duplicate policies
-	userToPolicy := make(map[string]string)
+	var owner *containerOwner
+	if ownedAction(route) {
+		owner = f.owners.lookup(route.ResourceID)
+	}
+
+	var evaluations, enforced []policyEvaluation
 	for _, policy := range policies {
-		for _, u := range policy.Users {
-			if userPolicy, ok := userToPolicy[u]; ok {
-				logrus.Warnf("User %q already appears in policy %q. Only single policy applies. Undefined policy behavior %q",
-					u,
-					userPolicy,
-					policy.Name)
-			}
-			userToPolicy[u] = policy.Name
+		evaluation := evaluatePolicy(policy, authZReq, route, groups, owner)
+		evaluations = append(evaluations, evaluation)
+		if policy.Mode != core.ModeMonitor {
+			enforced = append(enforced, evaluation)
 		}
+	}
 
+	res = combineEvaluations(authZReq.User, action, enforced)
+	if !res.Allow || len(enforced) == len(evaluations) {
+		return res
 	}
+	if monitored := combineEvaluations(authZReq.User, action, evaluations); !monitored.Allow {
+		return core.MonitorResponse(monitored)
+	}
+	return res
+}
 
-	f.policies = policies
-	return nil
+// userPolicies returns the policies that apply to the request user and the user groups.
+// If the request client certificate is not issued by a trusted issuer, a deny response is returned instead
+func (f *basicAuthorizer) userPolicies(authZReq *authorization.Request) ([]*BasicPolicy, []string, *authorization.Response) {
+	issuers := core.VerifiedIssuers(authZReq, f.issuerCAs)
+	if len(f.settings.TrustedIssuers) > 0 && !issuerAllowed(f.settings.TrustedIssuers, issuers) {
+		return nil, nil, &authorization.Response{
+			Allow: false,
+			Msg:   fmt.Sprintf("client certificate of user '%s' is not issued by a trusted issuer", authZReq.User),
+		}
+	}
+
+	principal := f.identity.PrincipalWithIssuers(authZReq, issuers)
+	var groups []string
+	if f.settings.GroupResolver != nil {
+		groups = f.settings.GroupResolver.Groups(authZReq)
+	}
+
+	snapshot := f.snapshot()
+	var policies []*BasicPolicy
+	for _, i := range snapshot.userPolicies(principal, groups) {
+		policy := &snapshot.policies[i]
+		if len(policy.Issuers) > 0 && !issuerAllowed(policy.Issuers, issuers) {
+			continue
+		}
+		policies = append(policies, policy)
+	}
+	return policies, groups, nil
 }
 
-func (f *basicAuthorizer) AuthZReq(authZReq *authorization.Request) *authorization.Response {
+// combineEvaluations combines the evaluations of all the policies that apply to the user into a single decision
+func combineEvaluations(user, action string, evaluations []policyEvaluation) *authorization.Response {
+	var allowed, denied, rejected []policyEvaluation
+	for _, evaluation := range evaluations {
+		switch {
+		case evaluation.deny:
+			denied = append(denied, evaluation)
+		case evaluation.allow:
+			allowed = append(allowed, evaluation)
+		default:
+			rejected = append(rejected, evaluation)
+		}
+	}
 
-	logrus.Debugf("Received AuthZ request, method: '%s', url: '%s'", authZReq.RequestMethod, authZReq.RequestURI)
-	url, err := url.Parse(authZReq.RequestURI)
-	if err != nil {
+	if len(denied) > 0 {
 		return &authorization.Response{
 			Allow: false,
-			Msg:   fmt.Sprintf("invalid request URI: %s", err.Error()),
+			Msg:   fmt.Sprintf("action '%s' denied for user '%s' by %s", action, user, describeEvaluations(denied)),
 		}
 	}
-	action := core.ParseRoute(authZReq.RequestMethod, url.Path)
-	for _, policy := range f.policies {
-		for _, user := range policy.Users {
-			if user == authZReq.User {
-				for _, policyActionPattern := range policy.Actions {
-					match, err := regexp.MatchString(policyActionPattern, action)
-					if err != nil {
-						logrus.Errorf("Failed to evaulate action %q against policy %q error %q", action, policyActionPattern, err.Error())
-					}
-
-					if match {
-						if policy.Readonly && authZReq.RequestMethod != http.MethodGet {
-							return &authorization.Response{
-								Allow: false,
-								Msg:   fmt.Sprintf("action '%s' not allowed for user '%s' by readonly policy '%s'", action, authZReq.User, policy.Name),
-							}
-						}
-
-						return &authorization.Response{
-							Allow: true,
-							Msg:   fmt.Sprintf("action '%s' allowed for user '%s' by policy '%s'", action, authZReq.User, policy.Name),
-						}
-					}
-				}
-				return &authorization.Response{
-					Allow: false,
-					Msg:   fmt.Sprintf("action '%s' denied for user '%s' by policy '%s'", action, authZReq.User, policy.Name),
-				}
-			}
+
+	if len(allowed) > 0 {
+		return &authorization.Response{
+			Allow: true,
+			Msg:   fmt.Sprintf("action '%s' allowed for user '%s' by %s", action, user, describeEvaluations(allowed)),
+		}
+	}
+
+	if len(rejected) > 0 {
+		return &authorization.Response{
+			Allow: false,
+			Msg:   fmt.Sprintf("action '%s' denied for user '%s' by %s", action, user, describeEvaluations(rejected)),
 		}
 	}
 
 	return &authorization.Response{
 		Allow: false,
-		Msg:   fmt.Sprintf("no policy applied (user: '%s' action: '%s')", authZReq.User, action),
+		Msg:   fmt.Sprintf("no policy applied (user: '%s' action: '%s')", user, action),
+	}
+}
+
+// policyEvaluation is the result of evaluating a request against a single policy
+type policyEvaluation struct {
+	policy string // policy is the evaluated policy name
+	allow  bool   // allow indicates the policy allows the request
+	deny   bool   // deny indicates the policy explicitly denies the request, regardless of other policies
+	reason string // reason explains why the request is not allowed by the policy
+}
+
+// issuerAllowed checks whether any of the request verified issuers is in the allowed issuers fingerprints
+func issuerAllowed(allowedIssuers []string, issuers []string) bool {
+	for _, allowedIssuer := range allowedIssuers {
+		for _, issuer := range issuers {
+			if core.NormalizeFingerprint(allowedIssuer) == issuer {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// evaluatePolicy evaluates the request against a single policy, given the user groups and the owner of the requested container (if known)
+func evaluatePolicy(policy *BasicPolicy, authZReq *authorization.Request, route *core.RouteInfo, groups []string, owner *containerOwner) policyEvaluation {
+	action := route.Action
+	evaluation := policyEvaluation{policy: policy.Name}
+
+	if pattern, match := matchAction(policy.denyActions, action); match {
+		evaluation.deny = true
+		evaluation.reason = fmt.Sprintf("deny action '%s'", pattern)
+		return evaluation
+	}
+
+	if policy.DeprecatedAPIVersion != "" && !core.APIVersionGreaterThan(route.APIVersion, policy.DeprecatedAPIVersion) {
+		evaluation.deny = true
+		evaluation.reason = fmt.Sprintf("deprecated API version '%s'", route.APIVersion)
+		return evaluation
+	}
+
+	if _, match := matchAction(policy.actions, action); !match {
+		evaluation.reason = "action not allowed"
+		return evaluation
+	}
+
+	if policy.MinAPIVersion != "" && core.APIVersionLessThan(route.APIVersion, policy.MinAPIVersion) {
+		evaluation.reason = fmt.Sprintf("API version '%s' is lower than '%s'", route.APIVersion, policy.MinAPIVersion)
+		return evaluation
+	}
+
+	if policy.Readonly && authZReq.RequestMethod != http.MethodGet {
+		evaluation.reason = "readonly policy"
+		return evaluation
+	}
+
+	if !resourceAllowed(policy, route) {
+		evaluation.reason = fmt.Sprintf("%s '%s' not allowed", route.Resource, route.ResourceID)
+		if action == core.ActionContainerCreate {
+			evaluation.reason = fmt.Sprintf("container name '%s' not allowed", route.Query.Get("name"))
+		}
+		return evaluation
+	}
+
+	if action == core.ActionContainerCreate && policy.Container != nil {
+		if err := validateContainerCreate(policy.Container, authZReq.RequestBody); err != nil {
+			evaluation.reason = err.Error()
+			return evaluation
+		}
+	}
+
+	// Services run containers on the swarm nodes, with the same container restrictions
+	if (action == core.ActionServiceCreate || action == core.ActionServiceUpdate) && policy.Container != nil {
+		if err := validateServiceSpec(policy.Container, authZReq.RequestBody); err != nil {
+			evaluation.reason = err.Error()
+			return evaluation
+		}
+	}
+
+	if action == core.ActionContainerExecCreate && policy.Exec != nil {
+		if err := validateExecCreate(policy.Exec, authZReq.RequestBody); err != nil {
+			evaluation.reason = err.Error()
+			return evaluation
+		}
+	}
+
+	if action == core.ActionVolumeCreate && policy.Volume != nil {
+		if err := validateVolumeCreate(policy.Volume, authZReq.RequestBody); err != nil {
+			evaluation.reason = err.Error()
+			return evaluation
+		}
+	}
+
+	// Volumes can also be created by container mounts, with the same driver options
+	if action == core.ActionContainerCreate && policy.Volume != nil {
+		if err := validateContainerVolumes(policy.Volume, authZReq.RequestBody); err != nil {
+			evaluation.reason = err.Error()
+			return evaluation
+		}
+	}
+
+	if (action == core.ActionServiceCreate || action == core.ActionServiceUpdate) && policy.Volume != nil {
+		if err := validateServiceVolumes(policy.Volume, authZReq.RequestBody); err != nil {
+			evaluation.reason = err.Error()
+			return evaluation
+		}
+	}
+
+	if action == core.ActionNetworkCreate && policy.Network != nil {
+		if err := validateNetworkCreate(policy.Network, authZReq.RequestBody); err != nil {
+			evaluation.reason = err.Error()
+			return evaluation
+		}
+	}
+
+	if action == core.ActionImageBuild && policy.Build != nil {
+		if err := validateBuild(policy.Build, route.Query); err != nil {
+			evaluation.reason = err.Error()
+			return evaluation
+		}
+	}
+
+	if action == core.ActionContainerCreate && policy.OwnerLabel != "" {
+		if err := validateOwnerLabel(policy.OwnerLabel, authZReq.User, authZReq.RequestBody); err != nil {
+			evaluation.reason = err.Error()
+			return evaluation
+		}
+	}
+
+	if policy.Owner != "" && ownedAction(route) {
+		if err := validateOwner(policy.Owner, route, owner, authZReq.User, groups); err != nil {
+			evaluation.reason = err.Error()
+			return evaluation
+		}
+	}
+
+	if policy.Image != nil {
+		if err := validateImageRequest(policy.Image, route, authZReq.RequestBody); err != nil {
+			evaluation.reason = err.Error()
+			return evaluation
+		}
+	}
+
+	evaluation.allow = true
+	return evaluation
+}
+
+// matchAction returns the first action pattern that matches the action, according to the policy action index.
+// Actions that are not indexed (e.g., requests that are not mapped to any action) never match, not even the * pattern
+func matchAction(index map[string]*actionPattern, action string) (string, bool) {
+	if pattern := index[action]; pattern != nil {
+		return pattern.pattern, true
+	}
+	return "", false
+}
+
+// describeEvaluations describes the policies (and the reasons for denial, if any) that contributed to the response
+func describeEvaluations(evaluations []policyEvaluation) string {
+	var descriptions []string
+	for _, evaluation := range evaluations {
+		description := fmt.Sprintf("'%s'", evaluation.policy)
+		if evaluation.reason != "" {
+			description += fmt.Sprintf(" (%s)", evaluation.reason)
+		}
+		descriptions = append(descriptions, description)
+	}
+
+	if len(descriptions) == 1 {
+		return "policy " + descriptions[0]
+	}
+	return "policies " + strings.Join(descriptions, ", ")
+}
+
+// resourceAllowed checks whether the object the request refers to (or the container the request creates) is in the scope of the policy resource patterns
+func resourceAllowed(policy *BasicPolicy, route *core.RouteInfo) bool {
+	patterns, ok := policy.Resources[route.Resource]
+	if !ok {
+		return true
+	}
+	// Containers created without a name are named randomly, so the name is required to match the patterns
+	if route.Action == core.ActionContainerCreate {
+		name := strings.TrimPrefix(route.Query.Get("name"), "/")
+		return name != "" && policy.matchAny(patterns, name)
+	}
+	if route.ResourceID == "" {
+		return true
+	}
+	return matchResource(policy, route.Resource, patterns, strings.TrimPrefix(route.ResourceID, "/"))
+}
+
+// idReference matches the references docker can resolve as object ids or id prefixes (e.g., db12 or sha256:db12)
+var idReference = regexp.MustCompile(`^(sha256:)?[0-9a-f]+$`)
+
+// matchResource checks whether the object reference matches any of the resource patterns.
+// Docker resolves references that are not names as id prefixes (e.g., db12 refers to the container whose id starts with db12
+// unless a container is named db12), so references that can be ids only match literal patterns, e.g., db* does not match
+// a container id that starts with db. Volumes are referred by name only
+func matchResource(policy *BasicPolicy, resource string, patterns []string, ref string) bool {
+	if resource == core.ResourceVolume || !idReference.MatchString(ref) {
+		return policy.matchAny(patterns, ref)
+	}
+	for _, pattern := range patterns {
+		if isLiteralPattern(pattern) && pattern == ref {
+			return true
+		}
+	}
+	return false
+}
+
+// patternSet holds compiled glob and regular expression patterns, keyed by pattern.
+// Policies are compiled when they are loaded, patterns that are not in the set (e.g., built-in defaults) are compiled when matched
+type patternSet map[string]*regexp.Regexp
+
+// compilePatterns compiles the patterns into a pattern set
+func compilePatterns(patterns []string) (patternSet, error) {
+	set := make(patternSet, len(patterns))
+	for _, pattern := range patterns {
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %s", pattern, err.Error())
+		}
+		set[pattern] = re
+	}
+	return set, nil
+}
+
+// compilePattern compiles a glob pattern (* matches any sequence of characters, ? matches a single character)
+// or an anchored regular expression if the pattern has the regular expression prefix
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, regexPatternPrefix) {
+		return regexp.Compile("^(?:" + strings.TrimPrefix(pattern, regexPatternPrefix) + ")$")
+	}
+	return regexp.Compile(globToRegexp(pattern))
+}
+
+// isLiteralPattern checks whether the pattern only matches itself
+func isLiteralPattern(pattern string) bool {
+	return !strings.HasPrefix(pattern, regexPatternPrefix) && !strings.ContainsAny(pattern, "*?")
+}
+
+// match matches the value against the pattern
+func (s patternSet) match(pattern, value string) (bool, error) {
+	if re, ok := s[pattern]; ok {
+		return re.MatchString(value), nil
+	}
+	if isLiteralPattern(pattern) {
+		return pattern == value, nil
+	}
+	re, err := compilePattern(pattern)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(value), nil
+}
+
+// prefix returns the literal prefix that every value matching the pattern starts with
+func (s patternSet) prefix(pattern string) string {
+	if re, ok := s[pattern]; ok {
+		prefix, _ := re.LiteralPrefix()
+		return prefix
+	}
+	if isLiteralPattern(pattern) {
+		return pattern
 	}
+	return ""
 }
 
-// AuthZRes always allow responses from server
+// matchAny checks whether the value matches any of the patterns
+func (s patternSet) matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if match, err := s.match(pattern, value); err == nil && match {
+			return true
+		}
+	}
+	return false
+}
+
+// globToRegexp converts a glob pattern to the equivalent anchored regular expression
+func globToRegexp(glob string) string {
+	expr := regexp.QuoteMeta(glob)
+	expr = strings.Replace(expr, `\*`, ".*", -1)
+	expr = strings.Replace(expr, `\?`, ".", -1)
+	// Wildcards also match new lines, e.g., in multi line environment variables
+	return "(?s)^" + expr + "$"
+}
+
+// AuthZRes learns container owners from the responses, and validates list responses (container_list, image_list,
+// volume_list and network_list) do not reveal objects outside the scope of the policies that allowed the request,
+// and container_inspect responses do not reveal secrets, unless allowed by a policy.
+// Since the response body cannot be rewritten, the response is denied if any object is out of scope or any secret is revealed
 func (f *basicAuthorizer) AuthZRes(authZReq *authorization.Request) *authorization.Response {
+
+	route, err := core.ParseRequest(authZReq.RequestMethod, authZReq.RequestURI)
+	if err != nil {
+		return &authorization.Response{Allow: true}
+	}
+
+	policies, groups, res := f.userPolicies(authZReq)
+	if res != nil {
+		return res
+	}
+
+	f.learnOwners(authZReq, route, groups)
+	inspect := route.Action == core.ActionContainerInspect && len(f.settings.SecretPatterns) > 0
+	if !isListAction(route.Action) && !inspect {
+		return &authorization.Response{Allow: true}
+	}
+
+	// Only the enforced policies that allowed the request define the response scope
+	var owner *containerOwner
+	if ownedAction(route) {
+		owner = f.owners.lookup(route.ResourceID)
+	}
+	var scopes []*BasicPolicy
+	for _, policy := range policies {
+		if policy.Mode != core.ModeMonitor && evaluatePolicy(policy, authZReq, route, groups, owner).allow {
+			scopes = append(scopes, policy)
+		}
+	}
+
+	var msg string
+	if inspect {
+		msg, err = validateInspectResponse(scopes, f.secrets, authZReq)
+	} else {
+		err = validateListResponse(scopes, authZReq, route)
+	}
+	if err != nil {
+		return &authorization.Response{
+			Allow: false,
+			Msg:   fmt.Sprintf("action '%s' response denied for user '%s': %s", route.Action, authZReq.User, err.Error()),
+		}
+	}
+	if msg != "" {
+		return &authorization.Response{
+			Allow: true,
+			Msg:   fmt.Sprintf("action '%s' response allowed for user '%s': %s", route.Action, authZReq.User, msg),
+		}
+	}
 	return &authorization.Response{Allow: true}
 }
 
 // basicAuditor audit requset/response directly to standard output
 type basicAuditor struct {
 	logger   *logrus.Logger
+	identity *core.IdentityExtractor
 	settings *BasicAuditorSettings
 }
 
@@ -213,8 +701,9 @@ func NewBasicAuditor(settings *BasicAuditorSettings) core.Auditor {
 
 // BasicAuditorSettings are settings used by the basic auditor
 type BasicAuditorSettings struct {
-	LogHook string // LogHook is the log hook used to audit authorization data
-	LogPath string // LogPath is the path to audit log file (if file hook is specified)
+	LogHook         string   // LogHook is the log hook used to audit authorization data
+	LogPath         string   // LogPath is the path to audit log file (if file hook is specified)
+	PrincipalFields []string // PrincipalFields are the client certificate fields that are audited (all fields if empty)
 }
 
 func (b *basicAuditor) AuditRequest(req *authorization.Request, pluginRes *authorization.Response) error {
@@ -244,12 +733,72 @@ func (b *basicAuditor) AuditRequest(req *authorization.Request, pluginRes *autho
 		fields["err"] = pluginRes.Err
 	}
 
+	if core.WouldDeny(pluginRes) {
+		fields["would_deny"] = true
+	}
+
+	if principal := b.identity.Principal(req); len(principal.Attributes) > 0 {
+		fields["principal"] = principal.Attributes
+	}
+
 	b.logger.WithFields(fields).Info("Request")
 	return nil
 }
 
+// AuditResponse audits the responses that were denied, or carry an authorization message
 func (b *basicAuditor) AuditResponse(req *authorization.Request, pluginRes *authorization.Response) error {
-	// Only log requests
+
+	if req == nil {
+		return fmt.Errorf("Authorization request is nil")
+	}
+
+	if pluginRes == nil {
+		return fmt.Errorf("Authorization response is nil")
+	}
+
+	if pluginRes.Allow && pluginRes.Msg == "" && pluginRes.Err == "" {
+		return nil
+	}
+
+	err := b.init()
+	if err != nil {
+		return err
+	}
+
+	fields := logrus.Fields{
+		"method": req.RequestMethod,
+		"uri":    req.RequestURI,
+		"user":   req.User,
+		"status": req.ResponseStatusCode,
+		"allow":  pluginRes.Allow,
+		"msg":    pluginRes.Msg,
+	}
+
+	if pluginRes.Err != "" {
+		fields["err"] = pluginRes.Err
+	}
+
+	if core.WouldDeny(pluginRes) {
+		fields["would_deny"] = true
+	}
+
+	if principal := b.identity.Principal(req); len(principal.Attributes) > 0 {
+		fields["principal"] = principal.Attributes
+	}
+
+	b.logger.WithFields(fields).Info("Response")
+	return nil
+}
+
+// AuditEvent audits an event that is not related to a specific request (e.g., policy load failure)
+func (b *basicAuditor) AuditEvent(event string, fields map[string]interface{}) error {
+
+	err := b.init()
+	if err != nil {
+		return err
+	}
+
+	b.logger.WithFields(logrus.Fields(fields)).Error(event)
 	return nil
 }
 
@@ -264,6 +813,12 @@ func (b *basicAuditor) init() error {
 		return nil
 	}
 
+	identity, err := core.NewIdentityExtractor(b.settings.PrincipalFields, nil)
+	if err != nil {
+		return err
+	}
+	b.identity = identity
+
 	b.logger = logrus.New()
 	b.logger.Formatter = &logrus.JSONFormatter{}
 
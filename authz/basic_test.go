@@ -1,10 +1,15 @@
 package authz
 
 import (
+	"crypto/x509/pkix"
+	"fmt"
 	"github.com/docker/docker/pkg/authorization"
 	"github.com/stretchr/testify/assert"
+	"github.com/twistlock/authz/core"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -46,6 +51,204 @@ func TestPolicyApply(t *testing.T) {
 	}
 }
 
+func TestDenyActionsPolicy(t *testing.T) {
+
+	policy := `{"name":"policy_1","users":["user_1"],"actions":["*"],"deny_actions":["swarm_leave","container_exec"]}
+	           {"name":"policy_2","users":["user_2"],"actions":["container"],"deny_actions":["container_create"]}`
+
+	const policyFileName = "/tmp/policy_deny.json"
+	err := ioutil.WriteFile(policyFileName, []byte(policy), 0755)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		method string
+		uri    string
+		user   string
+		allow  bool
+	}{
+		{http.MethodGet, "/v1.39/version", "user_1", true},              // All actions allowed
+		{http.MethodPost, "/v1.39/containers/create", "user_1", true},   // All actions allowed
+		{http.MethodPost, "/v1.39/swarm/leave", "user_1", false},        // Denied action
+		{http.MethodPost, "/v1.39/containers/id/exec", "user_1", false}, // Denied action (exec create)
+		{http.MethodPost, "/v1.39/exec/id/start", "user_1", false},      // Denied action (exec start)
+		{http.MethodPost, "/v1.39/containers/id/start", "user_2", true}, // Allowed action
+		{http.MethodPost, "/v1.39/containers/create", "user_2", false},  // Denied action overrides allowed action
+		{http.MethodPost, "/v1.39/unknown", "user_1", false},            // Requests not mapped to an action are denied
+	}
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyFileName})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	for _, test := range tests {
+		res := authorizer.AuthZReq(&authorization.Request{RequestMethod: test.method, RequestURI: test.uri, User: test.user})
+		assert.Equal(t, test.allow, res.Allow, "Request %s %s by %s must be allowed/denied based on policy", test.method, test.uri, test.user)
+	}
+}
+
+func TestAPIVersionPolicy(t *testing.T) {
+
+	policy := `{"name":"new_clients","users":["alice","bob"],"actions":["container"],"min_api_version":"1.40"}
+	           {"name":"legacy","users":["bob"],"actions":["container_list"]}
+	           {"name":"no_deprecated","users":["bob"],"actions":[],"deprecated_api_version":"1.23"}`
+
+	const policyFileName = "/tmp/policy_api_version.json"
+	err := ioutil.WriteFile(policyFileName, []byte(policy), 0755)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		method string
+		uri    string
+		user   string
+		allow  bool
+	}{
+		{http.MethodGet, "/v1.40/containers/json", "alice", true},     // Minimum version
+		{http.MethodGet, "/v1.41/containers/json", "alice", true},     // Greater than minimum version
+		{http.MethodGet, "/containers/json", "alice", true},           // No version is the latest version
+		{http.MethodGet, "/v1.39/containers/json", "alice", false},    // Lower than minimum version
+		{http.MethodGet, "/v1.9/containers/json", "alice", false},     // Versions are compared numerically
+		{http.MethodGet, "/v1.30/containers/json", "bob", true},       // Allowed by policy without minimum version
+		{http.MethodPost, "/v1.30/containers/id/start", "bob", false}, // Lower than minimum version
+		{http.MethodGet, "/v1.23/containers/json", "bob", false},      // Deprecated version overrides allow
+		{http.MethodPost, "/v1.23/containers/id/copy", "bob", false},  // Deprecated version
+	}
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyFileName})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	for _, test := range tests {
+		res := authorizer.AuthZReq(&authorization.Request{RequestMethod: test.method, RequestURI: test.uri, User: test.user})
+		assert.Equal(t, test.allow, res.Allow, "Request %s %s by %s must be allowed/denied based on policy: %s", test.method, test.uri, test.user, res.Msg)
+	}
+
+	err = ioutil.WriteFile(policyFileName, []byte(`{"name":"invalid","users":["alice"],"actions":["*"],"min_api_version":"v1.40"}`), 0755)
+	assert.NoError(t, err)
+	authorizer = NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyFileName})
+	assert.Error(t, authorizer.Init(), "Invalid API version must be rejected")
+}
+
+func TestMultiplePoliciesApply(t *testing.T) {
+
+	policy := `{"name":"team_a","users":["alice","bob"],"actions":["container_list","container_inspect"]}
+	           {"name":"ops","users":["alice"],"actions":["container_restart","container_list"]}
+	           {"name":"no_swarm","users":["alice","bob"],"actions":[],"deny_actions":["swarm"]}
+	           {"name":"admins","users":["alice"],"actions":["swarm"]}`
+
+	const policyFileName = "/tmp/policy_multiple.json"
+	err := ioutil.WriteFile(policyFileName, []byte(policy), 0755)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		method           string
+		uri              string
+		user             string
+		allow            bool
+		expectedPolicies []string // expectedPolicies are the policy names that should appear in the message
+	}{
+		{http.MethodGet, "/v1.39/containers/json", "alice", true, []string{"team_a", "ops"}},            // Allowed by both policies
+		{http.MethodGet, "/v1.39/containers/id/json", "alice", true, []string{"team_a"}},                // Allowed by first policy
+		{http.MethodPost, "/v1.39/containers/id/restart", "alice", true, []string{"ops"}},               // Allowed by second policy
+		{http.MethodPost, "/v1.39/containers/id/restart", "bob", false, []string{"team_a", "no_swarm"}}, // Not allowed by any policy
+		{http.MethodPost, "/v1.39/swarm/leave", "alice", false, []string{"no_swarm"}},                   // Deny overrides allow
+		{http.MethodPost, "/v1.39/containers/id/kill", "carol", false, nil},                             // No policy applies
+	}
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyFileName})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	for _, test := range tests {
+		res := authorizer.AuthZReq(&authorization.Request{RequestMethod: test.method, RequestURI: test.uri, User: test.user})
+		assert.Equal(t, test.allow, res.Allow, "Request %s %s by %s must be allowed/denied based on policy", test.method, test.uri, test.user)
+		for _, policy := range test.expectedPolicies {
+			assert.Contains(t, res.Msg, policy, "Policy name must appear in the response")
+		}
+	}
+}
+
+func TestMonitorPolicy(t *testing.T) {
+
+	policy := `{"name":"all","users":["alice"],"actions":["*"]}
+	           {"name":"no_exec","users":["alice"],"actions":[],"deny_actions":["container_exec"],"mode":"monitor"}
+	           {"name":"readonly","users":["bob"],"actions":["*"],"readonly":true,"mode":"monitor"}`
+
+	const policyFileName = "/tmp/policy_monitor.json"
+	err := ioutil.WriteFile(policyFileName, []byte(policy), 0755)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		method    string
+		uri       string
+		user      string
+		allow     bool
+		wouldDeny bool
+	}{
+		{http.MethodGet, "/v1.39/containers/json", "alice", true, false},       // Allowed by all policies
+		{http.MethodPost, "/v1.39/containers/id/exec", "alice", true, true},    // Denied only by monitor policy
+		{http.MethodGet, "/v1.39/containers/json", "bob", false, false},        // No enforced policy applies
+		{http.MethodPost, "/v1.39/containers/id/restart", "bob", false, false}, // Enforced decision is deny
+	}
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyFileName})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	for _, test := range tests {
+		res := authorizer.AuthZReq(&authorization.Request{RequestMethod: test.method, RequestURI: test.uri, User: test.user})
+		assert.Equal(t, test.allow, res.Allow, "Request %s %s by %s must be allowed/denied based on policy", test.method, test.uri, test.user)
+		assert.Equal(t, test.wouldDeny, core.WouldDeny(res), "Request %s %s by %s would-deny mismatch: %s", test.method, test.uri, test.user, res.Msg)
+	}
+
+	const invalidPolicyFileName = "/tmp/policy_monitor_invalid.json"
+	err = ioutil.WriteFile(invalidPolicyFileName, []byte(`{"name":"audit","users":["alice"],"actions":["*"],"mode":"audit"}`), 0755)
+	assert.NoError(t, err)
+	assert.Error(t, NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: invalidPolicyFileName}).Init(), "Unsupported mode must fail")
+}
+
+func TestResourcePolicy(t *testing.T) {
+
+	policy := `{"name":"policy_1","users":["alice"],"actions":["container"],"resources":{"container":["alice-*"]}}
+	           {"name":"policy_2","users":["ci"],"actions":["image_delete","image_list"],"resources":{"image":["registry.local/ci/*"]}}
+	           {"name":"policy_3","users":["bob"],"actions":["volume"],"resources":{"volume":["re:bob-[0-9]+"]}}
+	           {"name":"policy_4","users":["dan"],"actions":["container_inspect","image_delete","volume_remove"],"resources":{"container":["db*","cafe01"],"image":["a*"],"volume":["re:[0-9a-f]{8}"]}}`
+
+	const policyFileName = "/tmp/policy_resources.json"
+	err := ioutil.WriteFile(policyFileName, []byte(policy), 0755)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		method string
+		uri    string
+		user   string
+		allow  bool
+	}{
+		{http.MethodPost, "/v1.21/containers/alice-web/stop", "alice", true},         // Container name matches pattern
+		{http.MethodPost, "/v1.21/containers/bob-web/stop", "alice", false},          // Container name does not match pattern
+		{http.MethodGet, "/v1.21/containers/json", "alice", true},                    // No specific container in request
+		{http.MethodDelete, "/v1.21/images/registry.local/ci/app:v1", "ci", true},    // Image under allowed repository
+		{http.MethodDelete, "/v1.21/images/registry.local/prod/app:v1", "ci", false}, // Image outside allowed repository
+		{http.MethodGet, "/v1.21/images/json", "ci", true},                           // No specific image in request
+		{http.MethodDelete, "/v1.21/volumes/bob-12", "bob", true},                    // Volume matches regular expression
+		{http.MethodDelete, "/v1.21/volumes/bob-12-backup", "bob", false},            // Regular expressions are anchored
+		{http.MethodPost, "/v1.21/containers/create?name=alice-web", "alice", true},  // Created container name matches pattern
+		{http.MethodPost, "/v1.21/containers/create?name=/alice-db", "alice", true},  // Created container name with leading slash
+		{http.MethodPost, "/v1.21/containers/create?name=bob-web", "alice", false},   // Created container name does not match pattern
+		{http.MethodPost, "/v1.21/containers/create", "alice", false},                // Created container is named randomly
+		{http.MethodGet, "/v1.21/containers/db-primary/json", "dan", true},           // Container name matches glob
+		{http.MethodGet, "/v1.21/containers/dbf3a1/json", "dan", false},              // Container id prefix does not match glob
+		{http.MethodGet, "/v1.21/containers/cafe01/json", "dan", true},               // Literal pattern matches reference as is
+		{http.MethodDelete, "/v1.21/images/alpine", "dan", true},                     // Image name matches glob
+		{http.MethodDelete, "/v1.21/images/a1b2c3", "dan", false},                    // Image id prefix does not match glob
+		{http.MethodDelete, "/v1.21/images/sha256:a1b2c3", "dan", false},             // Image id does not match glob
+		{http.MethodDelete, "/v1.21/volumes/a1b2c3d4", "dan", true},                  // Volumes are referred by name only
+	}
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyFileName})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	for _, test := range tests {
+		res := authorizer.AuthZReq(&authorization.Request{RequestMethod: test.method, RequestURI: test.uri, User: test.user})
+		assert.Equal(t, test.allow, res.Allow, "Request %s %s by %s must be allowed/denied based on policy", test.method, test.uri, test.user)
+	}
+}
+
 func TestAuditRequestStdout(t *testing.T) {
 	auditor := NewBasicAuditor(&BasicAuditorSettings{LogHook: AuditHookStdout})
 	assert.NoError(t, auditor.AuditRequest(&authorization.Request{User: "user"}, &authorization.Response{Allow: true}))
@@ -66,3 +269,115 @@ func TestAuditRequestFile(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Contains(t, string(log), "allow", "Log doesn't container authorization data")
 }
+
+func TestAuditRequestPrincipal(t *testing.T) {
+	logPath := "/tmp/auth-broker-principal.log"
+	auditor := NewBasicAuditor(&BasicAuditorSettings{LogHook: AuditHookFile, LogPath: logPath, PrincipalFields: []string{"ou"}})
+	cert := newTestCertificate(t, pkix.Name{CommonName: "user", OrganizationalUnit: []string{"ops"}})
+	assert.NoError(t, auditor.AuditRequest(&authorization.Request{User: "user", RequestPeerCertificates: []*authorization.PeerCertificate{cert}}, &authorization.Response{Allow: true}))
+	log, err := ioutil.ReadFile(logPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(log), `"principal":{"ou":["ops"]}`, "Log doesn't contain the request principal")
+}
+
+func TestAuditRequestWouldDeny(t *testing.T) {
+	logPath := "/tmp/auth-broker-would-deny.log"
+	os.Remove(logPath)
+	auditor := NewBasicAuditor(&BasicAuditorSettings{LogHook: AuditHookFile, LogPath: logPath})
+	res := core.MonitorResponse(&authorization.Response{Allow: false, Msg: "action 'container_exec_create' denied"})
+	assert.NoError(t, auditor.AuditRequest(&authorization.Request{User: "user"}, res))
+	log, err := ioutil.ReadFile(logPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(log), `"would_deny":true`, "Log doesn't contain the would-deny decision")
+}
+
+func TestAuditResponse(t *testing.T) {
+	logPath := "/tmp/auth-broker-response.log"
+	os.Remove(logPath)
+	auditor := NewBasicAuditor(&BasicAuditorSettings{LogHook: AuditHookFile, LogPath: logPath})
+	req := &authorization.Request{User: "user", RequestURI: "/v1.39/containers/web/json", ResponseStatusCode: http.StatusOK}
+	assert.NoError(t, auditor.AuditResponse(req, &authorization.Response{Allow: true}))
+	assert.NoError(t, auditor.AuditResponse(req, &authorization.Response{Allow: false, Msg: "secret environment variables 'DB_PASSWORD' cannot be revealed"}))
+	log, err := ioutil.ReadFile(logPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(log), "Response"), "Only responses with decisions must be logged")
+	assert.Contains(t, string(log), "DB_PASSWORD", "Log doesn't contain the response decision")
+}
+
+func TestAuditEvent(t *testing.T) {
+	logPath := "/tmp/auth-broker-event.log"
+	os.Remove(logPath)
+	auditor := NewBasicAuditor(&BasicAuditorSettings{LogHook: AuditHookFile, LogPath: logPath})
+	eventAuditor, ok := auditor.(core.EventAuditor)
+	if !assert.True(t, ok, "Basic auditor must audit events") {
+		return
+	}
+	assert.NoError(t, eventAuditor.AuditEvent("Policy load failed", map[string]interface{}{"err": "invalid policy #1: name is missing"}))
+	log, err := ioutil.ReadFile(logPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(log), `"msg":"Policy load failed"`, "Log doesn't contain the event")
+	assert.Contains(t, string(log), "name is missing", "Log doesn't contain the event fields")
+}
+
+// benchmarkAuthorizer returns an authorizer with the given number of users, each with its own user and client certificate principal policies,
+// and a group policy per 100 users. It also returns the client certificate chain of the benchmarked user, issued by a trusted CA
+func benchmarkAuthorizer(b *testing.B, users int, user string) (core.Authorizer, []*authorization.PeerCertificate) {
+	ca, caKey := newTestIssuedCertificate(b, pkix.Name{CommonName: "ca"}, true, nil, nil)
+	leaf, _ := newTestIssuedCertificate(b, pkix.Name{CommonName: user, OrganizationalUnit: []string{"team_" + user + "/web"}, Organization: []string{"org_" + user + "-dev"}}, false, ca, caKey)
+	issuer := core.CertificateFingerprint(ca)
+
+	var policies []string
+	for i := 0; i < users; i++ {
+		policies = append(policies,
+			fmt.Sprintf(`{"name":"user_%d","users":["user_%d"],"actions":["container_list","container_inspect","image_*"],"deny_actions":["swarm_leave"],"resources":{"container":["user_%d-*"]}}`, i, i, i),
+			fmt.Sprintf(`{"name":"team_%d","principals":{"ou":["team_user_%d/*"]},"issuers":["%s"],"actions":["container_*"],"resources":{"container":["re:user_%d-[a-z]+"]}}`, i, i, issuer, i))
+		if i%10 == 0 {
+			policies = append(policies,
+				fmt.Sprintf(`{"name":"cn_%d","principals":{"cn":["user_%d"]},"actions":["image_*"]}`, i, i),
+				fmt.Sprintf(`{"name":"org_%d","principals":{"o":["re:org_user_%d(-[a-z]+)?"]},"actions":["volume_*"]}`, i, i))
+		}
+		if i%100 == 0 {
+			policies = append(policies, fmt.Sprintf(`{"name":"group_%d","groups":["group_%d"],"actions":["docker_*"]}`, i/100, i/100))
+		}
+	}
+
+	policyFileName := fmt.Sprintf("/tmp/policy_benchmark_%d.json", users)
+	if err := ioutil.WriteFile(policyFileName, []byte(strings.Join(policies, "\n")), 0644); err != nil {
+		b.Fatal(err)
+	}
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyFileName, TrustedIssuers: []string{issuer}})
+	if err := authorizer.Init(); err != nil {
+		b.Fatal(err)
+	}
+	return authorizer, []*authorization.PeerCertificate{(*authorization.PeerCertificate)(leaf), (*authorization.PeerCertificate)(ca)}
+}
+
+// BenchmarkAuthZReq measures the request latency as the number of users and policies grows, which is expected to stay flat.
+// Requests carry a client certificate chain, so principal matching and issuer verification are measured as well
+func BenchmarkAuthZReq(b *testing.B) {
+	for _, users := range []int{10, 1000, 10000} {
+		user := fmt.Sprintf("user_%d", users/2)
+		authorizer, certs := benchmarkAuthorizer(b, users, user)
+		requests := []struct {
+			name  string
+			uri   string
+			allow bool
+		}{
+			{"ping", "/v1.40/_ping", false},
+			{"container_list", "/v1.40/containers/json", true},
+			{"container_inspect", fmt.Sprintf("/v1.40/containers/%s-web/json", user), true},
+			{"image_inspect", "/v1.40/images/alpine/json", true},
+		}
+		for _, request := range requests {
+			b.Run(fmt.Sprintf("users=%d/%s", users, request.name), func(b *testing.B) {
+				req := &authorization.Request{RequestMethod: http.MethodGet, RequestURI: request.uri, User: user, RequestPeerCertificates: certs}
+				if authorizer.AuthZReq(req).Allow != request.allow {
+					b.Fatalf("Request %s must be allowed/denied", request.uri)
+				}
+				for i := 0; i < b.N; i++ {
+					authorizer.AuthZReq(req)
+				}
+			})
+		}
+	}
+}
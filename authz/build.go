@@ -0,0 +1,72 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// BuildPolicy restricts the build options that can be requested in image_build, i.e., the build network, the remote context
+// and the build arguments. Build tags (t) are restricted by the policy image restrictions, see ImagePolicy
+type BuildPolicy struct {
+	AllowHostNetwork bool     `json:"allow_host_network"` // AllowHostNetwork allows running build instructions in the host network namespace
+	RemoteHosts      []string `json:"remote_hosts"`       // RemoteHosts are the host patterns remote build contexts (git repositories or URLs) can be fetched from
+	DenyBuildArgs    []string `json:"deny_build_args"`    // DenyBuildArgs are the build argument name patterns that cannot be set (e.g., *_TOKEN)
+
+	patternSet // patternSet holds the compiled policy patterns, set when the policy is validated
+}
+
+// localContexts are the remote query values of builds whose context is sent by the client rather than fetched by docker daemon:
+// a context in the request body (empty), a BuildKit session (client-session) or the BuildKit frontend context (context)
+var localContexts = map[string]bool{"": true, "client-session": true, "context": true}
+
+// validateBuild validates the build request query parameters against the build policy
+func validateBuild(policy *BuildPolicy, query url.Values) error {
+	if strings.EqualFold(query.Get("networkmode"), "host") && !policy.AllowHostNetwork {
+		return fmt.Errorf("host network mode is not allowed")
+	}
+
+	if remote := query.Get("remote"); !localContexts[remote] {
+		host, err := remoteHost(remote)
+		if err != nil {
+			return err
+		}
+		if !policy.matchAny(policy.RemoteHosts, host) {
+			return fmt.Errorf("remote context host '%s' is not allowed", host)
+		}
+	}
+
+	if buildArgs := query.Get("buildargs"); buildArgs != "" {
+		var args map[string]*string
+		if err := json.Unmarshal([]byte(buildArgs), &args); err != nil {
+			return fmt.Errorf("invalid build arguments: %s", err.Error())
+		}
+		for name := range args {
+			if policy.matchAny(policy.DenyBuildArgs, name) {
+				return fmt.Errorf("build argument '%s' is not allowed", name)
+			}
+		}
+	}
+	return nil
+}
+
+// remoteHost returns the host of a remote build context, which is a URL or a git repository (e.g., git@github.com:org/repo.git)
+func remoteHost(remote string) (string, error) {
+	// Git SSH repository (user@host:path), as detected by docker daemon
+	if strings.HasPrefix(remote, "git@") {
+		host := strings.SplitN(strings.TrimPrefix(remote, "git@"), ":", 2)[0]
+		return strings.ToLower(host), nil
+	}
+
+	// Repositories without scheme (e.g., github.com/org/repo) are cloned by docker daemon over https
+	if !strings.Contains(remote, "://") {
+		remote = "https://" + remote
+	}
+
+	u, err := url.Parse(remote)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid remote context '%s'", remote)
+	}
+	return strings.ToLower(u.Hostname()), nil
+}
@@ -0,0 +1,83 @@
+package authz
+
+import (
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestValidateBuild(t *testing.T) {
+
+	policy := &BuildPolicy{
+		RemoteHosts:   []string{"github.com", "*.git.local"},
+		DenyBuildArgs: []string{"*_TOKEN", "*_PROXY"},
+	}
+
+	tests := []struct {
+		query          string
+		expectedReason string // expectedReason is the expected denial reason, empty if the request is allowed
+	}{
+		{"t=app", ""},
+		{"networkmode=bridge", ""},
+		{"networkmode=host", "host network mode is not allowed"},
+		{"networkmode=HOST", "host network mode is not allowed"},
+		{"remote=https://github.com/org/repo.git%23main:app", ""},
+		{"remote=git@github.com:org/repo.git", ""},
+		{"remote=github.com/org/repo", ""},
+		{"remote=ssh://git@ci.git.local/org/repo.git", ""},
+		{"remote=https://github.com@evil.io/repo.tar.gz", "remote context host 'evil.io' is not allowed"},
+		{"remote=https://github.com.evil.io/repo.git", "remote context host 'github.com.evil.io' is not allowed"},
+		{"remote=git@evil.io:org/repo.git", "remote context host 'evil.io' is not allowed"},
+		{"remote=https://", "invalid remote context 'https://'"},
+		{"remote=client-session", ""}, // BuildKit session context
+		{"remote=context", ""},        // BuildKit frontend context
+		{"remote=", ""},               // Context in request body
+		{`buildargs={"VERSION":"1.0"}`, ""},
+		{`buildargs={"NPM_TOKEN":"secret"}`, "build argument 'NPM_TOKEN' is not allowed"},
+		{`buildargs={"HTTP_PROXY":null}`, "build argument 'HTTP_PROXY' is not allowed"},
+		{`buildargs=["NPM_TOKEN"]`, "invalid build arguments: json: cannot unmarshal array into Go value of type map[string]*string"},
+	}
+
+	for _, test := range tests {
+		query, err := url.ParseQuery(test.query)
+		assert.NoError(t, err)
+		err = validateBuild(policy, query)
+		if test.expectedReason == "" {
+			assert.NoError(t, err, test.query)
+		} else if assert.Error(t, err, test.query) {
+			assert.Equal(t, test.expectedReason, err.Error(), test.query)
+		}
+	}
+
+	query, _ := url.ParseQuery("networkmode=host&remote=https://evil.io/repo.git")
+	assert.Error(t, validateBuild(&BuildPolicy{AllowHostNetwork: true}, query), "Remote context must be denied without allowed hosts")
+}
+
+func TestBuildPolicyApply(t *testing.T) {
+
+	policy := `{"name":"ci","users":["ci"],"actions":["image_build"],"build":{"remote_hosts":["github.com"]},"image":{"repositories":["registry.local/ci/*"]}}`
+
+	const policyFileName = "/tmp/policy_build.json"
+	err := ioutil.WriteFile(policyFileName, []byte(policy), 0755)
+	assert.NoError(t, err)
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyFileName})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	tests := []struct {
+		uri   string
+		allow bool
+	}{
+		{"/v1.39/build?t=registry.local/ci/app:v1&remote=github.com/org/app", true},
+		{"/v1.39/build?t=registry.local/ci/app:v1&networkmode=host", false}, // Host network not allowed
+		{"/v1.39/build?t=registry.local/prod/app:v1", false},                // Tag not allowed by image policy
+	}
+
+	for _, test := range tests {
+		res := authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: test.uri, User: "ci"})
+		assert.Equal(t, test.allow, res.Allow, "Request %s must be allowed/denied based on policy: %s", test.uri, res.Msg)
+	}
+}
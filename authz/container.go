@@ -0,0 +1,257 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"path"
+	"strings"
+)
+
+// ContainerPolicy restricts the container configuration that can be requested when creating containers, i.e., privileged mode,
+// host namespaces, added capabilities, bind mounts, devices, unconfined security options and cgroup parents
+type ContainerPolicy struct {
+	AllowPrivileged  bool     `json:"allow_privileged"`   // AllowPrivileged allows running privileged containers
+	Capabilities     []string `json:"capabilities"`       // Capabilities are the kernel capabilities that can be added (e.g., NET_ADMIN)
+	BindMounts       []string `json:"bind_mounts"`        // BindMounts are the host path patterns that can be bind mounted (e.g., /home/*)
+	AllowHostNetwork bool     `json:"allow_host_network"` // AllowHostNetwork allows using the host network namespace
+	AllowHostPID     bool     `json:"allow_host_pid"`     // AllowHostPID allows using the host PID namespace
+	AllowHostIPC     bool     `json:"allow_host_ipc"`     // AllowHostIPC allows using the host IPC namespace
+	AllowHostUTS     bool     `json:"allow_host_uts"`     // AllowHostUTS allows using the host UTS namespace
+	AllowHostUserns  bool     `json:"allow_host_userns"`  // AllowHostUserns allows disabling user namespace remapping
+	Devices          []string `json:"devices"`            // Devices are the host device path patterns that can be mapped (e.g., /dev/fuse)
+	AllowUnconfined  bool     `json:"allow_unconfined"`   // AllowUnconfined allows disabling the seccomp and apparmor profiles, SELinux labeling and system paths masking
+	CgroupParents    []string `json:"cgroup_parents"`     // CgroupParents are the cgroup parent patterns that can be used
+
+	patternSet // patternSet holds the compiled policy patterns, set when the policy is validated
+}
+
+// containerCreateConfig is the container create request body.
+// It mirrors the docker daemon request wrapper, which accepts host config attributes in the top level of the request for backward compatibility
+type containerCreateConfig struct {
+	*container.Config
+	InnerHostConfig       *container.HostConfig     `json:"HostConfig,omitempty"`
+	NetworkingConfig      *network.NetworkingConfig `json:"NetworkingConfig,omitempty"`
+	*container.HostConfig                           // Deprecated host config attributes in the top level of the request
+}
+
+// hostConfig returns the host config applied by the docker daemon
+func (c *containerCreateConfig) hostConfig() *container.HostConfig {
+	if c.InnerHostConfig != nil {
+		return c.InnerHostConfig
+	}
+	return c.HostConfig
+}
+
+// decodeContainerCreate decodes the container create request body
+func decodeContainerCreate(body []byte) (*containerCreateConfig, error) {
+	if len(body) == 0 {
+		return nil, fmt.Errorf("container configuration is missing in request body")
+	}
+
+	var config containerCreateConfig
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, fmt.Errorf("invalid container configuration: %s", err.Error())
+	}
+	return &config, nil
+}
+
+// validateContainerCreate validates the container create request body against the container policy
+func validateContainerCreate(policy *ContainerPolicy, body []byte) error {
+	config, err := decodeContainerCreate(body)
+	if err != nil {
+		return err
+	}
+
+	if err := validateNewerHostConfig(policy, body); err != nil {
+		return err
+	}
+
+	hostConfig := config.hostConfig()
+	if hostConfig == nil {
+		return nil
+	}
+	return validateHostConfig(policy, hostConfig)
+}
+
+// validateHostConfig validates the container host config against the container policy
+func validateHostConfig(policy *ContainerPolicy, hostConfig *container.HostConfig) error {
+	if hostConfig.Privileged && !policy.AllowPrivileged {
+		return fmt.Errorf("privileged mode is not allowed")
+	}
+
+	if hostConfig.NetworkMode.IsHost() && !policy.AllowHostNetwork {
+		return fmt.Errorf("host network mode is not allowed")
+	}
+	if hostConfig.PidMode.IsHost() && !policy.AllowHostPID {
+		return fmt.Errorf("host PID mode is not allowed")
+	}
+	if hostConfig.IpcMode.IsHost() && !policy.AllowHostIPC {
+		return fmt.Errorf("host IPC mode is not allowed")
+	}
+	if hostConfig.UTSMode.IsHost() && !policy.AllowHostUTS {
+		return fmt.Errorf("host UTS mode is not allowed")
+	}
+	if hostConfig.UsernsMode.IsHost() && !policy.AllowHostUserns {
+		return fmt.Errorf("host user namespace mode is not allowed")
+	}
+
+	if err := validateCapabilities(policy, hostConfig.CapAdd); err != nil {
+		return err
+	}
+
+	for _, bind := range hostConfig.Binds {
+		if source := bindSource(bind); source != "" {
+			if err := validateBindMount(policy, source); err != nil {
+				return err
+			}
+		}
+	}
+	for _, m := range hostConfig.Mounts {
+		if m.Type == mount.TypeBind {
+			if err := validateBindMount(policy, m.Source); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, device := range hostConfig.Devices {
+		if !policy.matchAny(policy.Devices, device.PathOnHost) {
+			return fmt.Errorf("device '%s' is not allowed", device.PathOnHost)
+		}
+	}
+	if len(hostConfig.DeviceCgroupRules) > 0 && !policy.allowsAllDevices() {
+		return fmt.Errorf("device cgroup rules are not allowed")
+	}
+
+	if !policy.AllowUnconfined {
+		for _, opt := range hostConfig.SecurityOpt {
+			if isUnconfined(opt) {
+				return fmt.Errorf("security option '%s' is not allowed", opt)
+			}
+			if isSeccompProfile(opt) {
+				return fmt.Errorf("custom seccomp profiles are not allowed")
+			}
+		}
+	}
+
+	if hostConfig.CgroupParent != "" && !policy.matchAny(policy.CgroupParents, hostConfig.CgroupParent) {
+		return fmt.Errorf("cgroup parent '%s' is not allowed", hostConfig.CgroupParent)
+	}
+
+	return nil
+}
+
+// validateCapabilities validates the added kernel capabilities against the container policy
+func validateCapabilities(policy *ContainerPolicy, capabilities []string) error {
+	for _, capability := range capabilities {
+		allowed := false
+		for _, allowedCapability := range policy.Capabilities {
+			if normalizeCapability(capability) == normalizeCapability(allowedCapability) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("capability '%s' is not allowed", capability)
+		}
+	}
+	return nil
+}
+
+// validateCapabilitySet validates the complete capabilities set against the container policy, where the default capabilities are always allowed
+func validateCapabilitySet(policy *ContainerPolicy, capabilities []string) error {
+	for _, capability := range capabilities {
+		if isDefaultCapability(capability) {
+			continue
+		}
+		if err := validateCapabilities(policy, []string{capability}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allowsAllDevices checks whether the device patterns allow mapping any host device (e.g., /dev/*),
+// since device cgroup rules grant access to devices by type and number rather than by path
+func (policy *ContainerPolicy) allowsAllDevices() bool {
+	return policy.matchAny(policy.Devices, "/dev/*")
+}
+
+// validateBindMount validates the bind mount host path against the container policy
+func validateBindMount(policy *ContainerPolicy, source string) error {
+	if !policy.matchAny(policy.BindMounts, path.Clean(source)) {
+		return fmt.Errorf("bind mount of '%s' is not allowed", source)
+	}
+	return nil
+}
+
+// bindSource returns the host path of a bind (source:destination[:options]), or empty string for named volumes
+func bindSource(bind string) string {
+	source := strings.SplitN(bind, ":", 2)[0]
+	if !strings.HasPrefix(source, "/") {
+		return ""
+	}
+	return source
+}
+
+// normalizeCapability converts capability names to canonical form (e.g., cap_net_admin to NET_ADMIN)
+func normalizeCapability(capability string) string {
+	return strings.TrimPrefix(strings.ToUpper(capability), "CAP_")
+}
+
+// isUnconfined checks whether the security option disables the seccomp or apparmor profile (e.g., seccomp=unconfined),
+// SELinux labeling (label=disable) or the masking of system paths such as /proc/kcore (systempaths=unconfined)
+func isUnconfined(opt string) bool {
+	fields := strings.FieldsFunc(opt, func(r rune) bool { return r == '=' || r == ':' })
+	if len(fields) != 2 {
+		return false
+	}
+	switch fields[0] {
+	case "seccomp", "apparmor", "systempaths":
+		return fields[1] == "unconfined"
+	case "label":
+		return fields[1] == "disable"
+	}
+	return false
+}
+
+// isSeccompProfile checks whether the security option sets a custom seccomp profile (e.g., seccomp={"defaultAction":...}),
+// which the docker CLI sends inline and which can allow any system call
+func isSeccompProfile(opt string) bool {
+	i := strings.IndexAny(opt, "=:")
+	if i < 0 || opt[:i] != "seccomp" {
+		return false
+	}
+	value := opt[i+1:]
+	return value != "unconfined" && value != "builtin"
+}
+
+// newerHostConfig are the host config attributes which the vendored API types do not have: the masked and read only system paths (API 1.40),
+// which the docker CLI sends empty for --security-opt systempaths=unconfined, and the complete capabilities set (API 1.40)
+type newerHostConfig struct {
+	MaskedPaths   []string `json:"MaskedPaths"`
+	ReadonlyPaths []string `json:"ReadonlyPaths"`
+	Capabilities  []string `json:"Capabilities"`
+}
+
+// validateNewerHostConfig validates the host config attributes which the vendored API types do not have against the container policy
+func validateNewerHostConfig(policy *ContainerPolicy, body []byte) error {
+	var config struct {
+		HostConfig      *newerHostConfig `json:"HostConfig"`
+		newerHostConfig                  // Deprecated host config attributes in the top level of the request
+	}
+	if err := json.Unmarshal(body, &config); err != nil {
+		return fmt.Errorf("invalid container configuration: %s", err.Error())
+	}
+	hostConfig := &config.newerHostConfig
+	if config.HostConfig != nil {
+		hostConfig = config.HostConfig
+	}
+	if !policy.AllowUnconfined && (hostConfig.MaskedPaths != nil || hostConfig.ReadonlyPaths != nil) {
+		return fmt.Errorf("overriding masked or read only system paths is not allowed")
+	}
+	return validateCapabilitySet(policy, hostConfig.Capabilities)
+}
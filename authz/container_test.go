@@ -0,0 +1,108 @@
+package authz
+
+import (
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestValidateContainerCreate(t *testing.T) {
+
+	policy := &ContainerPolicy{
+		Capabilities:  []string{"NET_ADMIN"},
+		BindMounts:    []string{"/home/*", "/var/run/app"},
+		Devices:       []string{"/dev/fuse"},
+		CgroupParents: []string{"/ci/*"},
+	}
+
+	tests := []struct {
+		body           string
+		expectedReason string // expectedReason is the expected denial reason, empty if the request is allowed
+	}{
+		{`{"Image":"busybox"}`, ""},
+		{`{"Image":"busybox","HostConfig":{"Privileged":true}}`, "privileged mode is not allowed"},
+		{`{"Image":"busybox","Privileged":true}`, "privileged mode is not allowed"}, // Deprecated top level host config
+		{`{"Image":"busybox","HostConfig":{"CapAdd":["cap_net_admin"]}}`, ""},
+		{`{"Image":"busybox","HostConfig":{"CapAdd":["SYS_ADMIN"]}}`, "capability 'SYS_ADMIN' is not allowed"},
+		{`{"Image":"busybox","HostConfig":{"Capabilities":["CAP_CHOWN","CAP_NET_ADMIN"]}}`, ""},
+		{`{"Image":"busybox","HostConfig":{"Capabilities":["CAP_CHOWN","CAP_SYS_ADMIN"]}}`, "capability 'CAP_SYS_ADMIN' is not allowed"},
+		{`{"Image":"busybox","Capabilities":["CAP_SYS_ADMIN"]}`, "capability 'CAP_SYS_ADMIN' is not allowed"}, // Deprecated top level host config
+		{`{"Image":"busybox","HostConfig":{"Binds":["/home/alice:/data:ro","cache:/cache"]}}`, ""},
+		{`{"Image":"busybox","HostConfig":{"Binds":["/:/host"]}}`, "bind mount of '/' is not allowed"},
+		{`{"Image":"busybox","HostConfig":{"Binds":["/home/../etc:/etc"]}}`, "bind mount of '/home/../etc' is not allowed"},
+		{`{"Image":"busybox","HostConfig":{"Mounts":[{"Type":"bind","Source":"/var/run/docker.sock","Target":"/s"}]}}`, "bind mount of '/var/run/docker.sock' is not allowed"},
+		{`{"Image":"busybox","HostConfig":{"Mounts":[{"Type":"volume","Source":"data","Target":"/data"}]}}`, ""},
+		{`{"Image":"busybox","HostConfig":{"NetworkMode":"host"}}`, "host network mode is not allowed"},
+		{`{"Image":"busybox","HostConfig":{"PidMode":"host"}}`, "host PID mode is not allowed"},
+		{`{"Image":"busybox","HostConfig":{"IpcMode":"host"}}`, "host IPC mode is not allowed"},
+		{`{"Image":"busybox","HostConfig":{"UTSMode":"host"}}`, "host UTS mode is not allowed"},
+		{`{"Image":"busybox","HostConfig":{"UsernsMode":"host"}}`, "host user namespace mode is not allowed"},
+		{`{"Image":"busybox","HostConfig":{"Devices":[{"PathOnHost":"/dev/fuse"}]}}`, ""},
+		{`{"Image":"busybox","HostConfig":{"Devices":[{"PathOnHost":"/dev/sda"}]}}`, "device '/dev/sda' is not allowed"},
+		{`{"Image":"busybox","HostConfig":{"DeviceCgroupRules":["b 8:* rmw"]}}`, "device cgroup rules are not allowed"},
+		{`{"Image":"busybox","HostConfig":{"SecurityOpt":["seccomp=unconfined"]}}`, "security option 'seccomp=unconfined' is not allowed"},
+		{`{"Image":"busybox","HostConfig":{"SecurityOpt":["apparmor:unconfined"]}}`, "security option 'apparmor:unconfined' is not allowed"},
+		{`{"Image":"busybox","HostConfig":{"SecurityOpt":["systempaths=unconfined"]}}`, "security option 'systempaths=unconfined' is not allowed"},
+		{`{"Image":"busybox","HostConfig":{"SecurityOpt":["label=disable"]}}`, "security option 'label=disable' is not allowed"},
+		{`{"Image":"busybox","HostConfig":{"SecurityOpt":["label=level:s0:c100"]}}`, ""},
+		{`{"Image":"busybox","HostConfig":{"SecurityOpt":["seccomp={\"defaultAction\":\"SCMP_ACT_ALLOW\"}"]}}`, "custom seccomp profiles are not allowed"},
+		{`{"Image":"busybox","HostConfig":{"SecurityOpt":["seccomp=builtin"]}}`, ""},
+		{`{"Image":"busybox","HostConfig":{"MaskedPaths":[],"ReadonlyPaths":[]}}`, "overriding masked or read only system paths is not allowed"},
+		{`{"Image":"busybox","MaskedPaths":["/proc/acpi"]}`, "overriding masked or read only system paths is not allowed"},
+		{`{"Image":"busybox","HostConfig":{"MaskedPaths":null}}`, ""},
+		{`{"Image":"busybox","HostConfig":{"SecurityOpt":["no-new-privileges"]}}`, ""},
+		{`{"Image":"busybox","HostConfig":{"CgroupParent":"/ci/job-1"}}`, ""},
+		{`{"Image":"busybox","HostConfig":{"CgroupParent":"/system.slice"}}`, "cgroup parent '/system.slice' is not allowed"},
+		{``, "container configuration is missing in request body"},
+	}
+
+	for _, test := range tests {
+		err := validateContainerCreate(policy, []byte(test.body))
+		if test.expectedReason == "" {
+			assert.NoError(t, err, test.body)
+		} else if assert.Error(t, err, test.body) {
+			assert.Equal(t, test.expectedReason, err.Error(), test.body)
+		}
+	}
+
+	unconfined := &ContainerPolicy{AllowUnconfined: true}
+	for _, body := range []string{
+		`{"Image":"busybox","HostConfig":{"SecurityOpt":["seccomp=unconfined","systempaths=unconfined","label:disable"]}}`,
+		`{"Image":"busybox","HostConfig":{"MaskedPaths":[],"ReadonlyPaths":[]}}`,
+		`{"Image":"busybox","HostConfig":{"SecurityOpt":["seccomp={\"defaultAction\":\"SCMP_ACT_ALLOW\"}"]}}`,
+	} {
+		assert.NoError(t, validateContainerCreate(unconfined, []byte(body)), body)
+	}
+
+	allDevices := &ContainerPolicy{Devices: []string{"/dev/*"}}
+	body := `{"Image":"busybox","HostConfig":{"DeviceCgroupRules":["b 8:* rmw"]}}`
+	assert.NoError(t, validateContainerCreate(allDevices, []byte(body)), body)
+}
+
+func TestContainerPolicyApply(t *testing.T) {
+
+	policy := `{"name":"policy_1","users":["alice"],"actions":["container"],"container":{"bind_mounts":["/home/alice/*"]}}
+	           {"name":"policy_2","users":["admin"],"actions":["container"]}`
+
+	const policyFileName = "/tmp/policy_container.json"
+	err := ioutil.WriteFile(policyFileName, []byte(policy), 0755)
+	assert.NoError(t, err)
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyFileName})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	body := []byte(`{"Image":"busybox","HostConfig":{"Privileged":true,"Binds":["/:/host"]}}`)
+	res := authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: "/v1.21/containers/create", User: "alice", RequestBody: body})
+	assert.False(t, res.Allow, "Privileged container must be denied")
+	assert.Contains(t, res.Msg, "privileged mode is not allowed", "Denial reason must appear in the response")
+	assert.Contains(t, res.Msg, "policy_1", "Policy name must appear in the response")
+
+	res = authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: "/v1.21/containers/create", User: "admin", RequestBody: body})
+	assert.True(t, res.Allow, "Container configuration must not be restricted without container policy")
+
+	body = []byte(`{"Image":"busybox","HostConfig":{"Binds":["/home/alice/src:/src"]}}`)
+	res = authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: "/v1.21/containers/create", User: "alice", RequestBody: body})
+	assert.True(t, res.Allow, "Allowed bind mount must be allowed")
+}
@@ -0,0 +1,100 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"strings"
+)
+
+// ExecPolicy restricts the exec instances that can be created in running containers (container_exec_create).
+// Command patterns are matched against the command arguments, where each space separated pattern argument is a glob
+// that matches a single command argument (e.g., cat /var/log/* matches cat /var/log/syslog, but not cat /var/log/a /etc/shadow).
+// The last pattern argument can be ** to match any remaining arguments (e.g., sh ** matches sh -c id)
+type ExecPolicy struct {
+	AllowPrivileged bool     `json:"allow_privileged"` // AllowPrivileged allows running privileged exec instances
+	AllowRoot       bool     `json:"allow_root"`       // AllowRoot allows running exec instances explicitly as root (root or 0, with or without group)
+	Commands        []string `json:"commands"`         // Commands are the command patterns that can be executed (any command if empty)
+	DenyCommands    []string `json:"deny_commands"`    // DenyCommands are the command patterns that cannot be executed, regardless of Commands
+
+	patternSet // patternSet holds the compiled policy patterns, set when the policy is validated
+}
+
+// anyArguments is the command pattern argument that matches any remaining arguments
+const anyArguments = "**"
+
+// validateExecCreate validates the exec create request body against the exec policy
+func validateExecCreate(policy *ExecPolicy, body []byte) error {
+	if len(body) == 0 {
+		return fmt.Errorf("exec configuration is missing in request body")
+	}
+
+	var config types.ExecConfig
+	if err := json.Unmarshal(body, &config); err != nil {
+		return fmt.Errorf("invalid exec configuration: %s", err.Error())
+	}
+
+	if config.Privileged && !policy.AllowPrivileged {
+		return fmt.Errorf("privileged exec is not allowed")
+	}
+
+	if !policy.AllowRoot && isRootUser(config.User) {
+		return fmt.Errorf("exec as user '%s' is not allowed", config.User)
+	}
+
+	command := strings.Join(config.Cmd, " ")
+	for _, pattern := range policy.DenyCommands {
+		if matchCommand(policy.patternSet, pattern, config.Cmd) {
+			return fmt.Errorf("command '%s' is not allowed", command)
+		}
+	}
+
+	if len(policy.Commands) == 0 {
+		return nil
+	}
+	for _, arg := range config.Cmd {
+		// Wildcards match any path, so path traversal can escape an allowed directory (e.g., /var/log/../../etc/shadow)
+		if hasParentPathElement(arg) {
+			return fmt.Errorf("command '%s' is not allowed: argument '%s' contains parent path element", command, arg)
+		}
+	}
+	for _, pattern := range policy.Commands {
+		if matchCommand(policy.patternSet, pattern, config.Cmd) {
+			return nil
+		}
+	}
+	return fmt.Errorf("command '%s' is not allowed", command)
+}
+
+// matchCommand matches the command arguments against a command pattern
+func matchCommand(patterns patternSet, pattern string, args []string) bool {
+	patternArgs := strings.Fields(pattern)
+	for i, patternArg := range patternArgs {
+		if patternArg == anyArguments && i == len(patternArgs)-1 {
+			return true
+		}
+		if i >= len(args) {
+			return false
+		}
+		if match, err := patterns.match(patternArg, args[i]); err != nil || !match {
+			return false
+		}
+	}
+	return len(patternArgs) == len(args)
+}
+
+// isRootUser checks whether the exec user (user, uid, user:group or uid:gid) is root
+func isRootUser(user string) bool {
+	name := strings.TrimSpace(strings.SplitN(user, ":", 2)[0])
+	return name == "root" || (name != "" && strings.TrimLeft(name, "0") == "")
+}
+
+// hasParentPathElement checks whether the argument contains a parent (..) path element
+func hasParentPathElement(arg string) bool {
+	for _, element := range strings.FieldsFunc(arg, func(r rune) bool { return r == '/' || r == '=' }) {
+		if element == ".." {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package authz
+
+import (
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestValidateExecCreate(t *testing.T) {
+
+	policy := &ExecPolicy{
+		Commands:     []string{"cat /var/log/*", "ls **", "sh -c id"},
+		DenyCommands: []string{"ls -R **"},
+	}
+
+	tests := []struct {
+		body           string
+		expectedReason string // expectedReason is the expected denial reason, empty if the request is allowed
+	}{
+		{`{"Cmd":["cat","/var/log/syslog"]}`, ""},
+		{`{"Cmd":["ls"]}`, ""},
+		{`{"Cmd":["ls","-l","/tmp"]}`, ""},
+		{`{"Cmd":["sh","-c","id"]}`, ""},
+		{`{"Cmd":["sh"]}`, "command 'sh' is not allowed"},
+		{`{"Cmd":["sh","-c","id; sh"]}`, "command 'sh -c id; sh' is not allowed"},
+		{`{"Cmd":["cat","/var/log/syslog","/etc/shadow"]}`, "command 'cat /var/log/syslog /etc/shadow' is not allowed"},
+		{`{"Cmd":["cat","/var/log/../../etc/shadow"]}`, "command 'cat /var/log/../../etc/shadow' is not allowed: argument '/var/log/../../etc/shadow' contains parent path element"},
+		{`{"Cmd":["ls","-R","/"]}`, "command 'ls -R /' is not allowed"},
+		{`{"Cmd":["ls"],"Privileged":true}`, "privileged exec is not allowed"},
+		{`{"Cmd":["ls"],"User":"root"}`, "exec as user 'root' is not allowed"},
+		{`{"Cmd":["ls"],"User":"0:0"}`, "exec as user '0:0' is not allowed"},
+		{`{"Cmd":["ls"],"User":"00"}`, "exec as user '00' is not allowed"},
+		{`{"Cmd":["ls"],"User":"root:app"}`, "exec as user 'root:app' is not allowed"},
+		{`{"Cmd":["ls"],"User":"app:0"}`, ""},
+		{`{"Cmd":["ls"],"User":"1000"}`, ""},
+		{``, "exec configuration is missing in request body"},
+	}
+
+	for _, test := range tests {
+		err := validateExecCreate(policy, []byte(test.body))
+		if test.expectedReason == "" {
+			assert.NoError(t, err, test.body)
+		} else if assert.Error(t, err, test.body) {
+			assert.Equal(t, test.expectedReason, err.Error(), test.body)
+		}
+	}
+
+	assert.NoError(t, validateExecCreate(&ExecPolicy{AllowPrivileged: true, AllowRoot: true}, []byte(`{"Cmd":["sh"],"User":"root","Privileged":true}`)))
+}
+
+func TestExecPolicyApply(t *testing.T) {
+
+	policy := `{"name":"logs","users":["alice"],"actions":["container_exec"],"exec":{"commands":["cat /var/log/*"]}}`
+
+	const policyFileName = "/tmp/policy_exec.json"
+	err := ioutil.WriteFile(policyFileName, []byte(policy), 0755)
+	assert.NoError(t, err)
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyFileName})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	res := authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: "/v1.39/containers/web/exec", User: "alice",
+		RequestBody: []byte(`{"Cmd":["sh"]}`)})
+	assert.False(t, res.Allow, "Command not allowed by policy must be denied")
+	assert.Contains(t, res.Msg, "command 'sh' is not allowed", "Denial reason must appear in the response")
+
+	res = authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: "/v1.39/containers/web/exec", User: "alice",
+		RequestBody: []byte(`{"Cmd":["cat","/var/log/app.log"]}`)})
+	assert.True(t, res.Allow, res.Msg)
+
+	res = authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: "/v1.39/exec/1234/start", User: "alice"})
+	assert.True(t, res.Allow, "Exec start is not restricted by exec policy")
+}
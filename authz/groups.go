@@ -0,0 +1,149 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/twistlock/authz/core"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// fileGroupResolver resolves user groups from a local group file.
+// The group file maps each group to its users, in JSON or YAML format (according to the file extension), e.g.,
+//
+//	{"ops":["alice","bob"],"dev":["carol"]}
+//
+// The group file is continuously monitored and reloaded upon changes
+type fileGroupResolver struct {
+	settings   *FileGroupResolverSettings
+	lock       sync.RWMutex
+	userGroups map[string][]string // userGroups maps each user to the groups the user belongs to
+}
+
+// FileGroupResolverSettings provides settings for the group file resolver
+type FileGroupResolverSettings struct {
+	GroupPath string // GroupPath is the path to the group file
+}
+
+// NewFileGroupResolver creates a new group resolver that resolves user groups from a local group file
+func NewFileGroupResolver(settings *FileGroupResolverSettings) core.GroupResolver {
+	return &fileGroupResolver{settings: settings}
+}
+
+// Init loads the group file from disk
+func (r *fileGroupResolver) Init() error {
+	err := r.loadGroups()
+	if err != nil {
+		return err
+	}
+	reloadOnSignal(r.settings.GroupPath, r.loadGroups)
+	return watchFile(r.settings.GroupPath, r.loadGroups)
+}
+
+func (r *fileGroupResolver) loadGroups() error {
+	data, err := ioutil.ReadFile(r.settings.GroupPath)
+	if err != nil {
+		return err
+	}
+
+	var groups map[string][]string
+	switch filepath.Ext(r.settings.GroupPath) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &groups)
+	default:
+		err = json.Unmarshal(data, &groups)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse group file %q: %s", r.settings.GroupPath, err.Error())
+	}
+
+	userGroups := make(map[string][]string)
+	for group, users := range groups {
+		for _, user := range users {
+			userGroups[user] = append(userGroups[user], group)
+		}
+	}
+	for _, groups := range userGroups {
+		sort.Strings(groups)
+	}
+	logrus.Infof("Loaded '%d' groups", len(groups))
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.userGroups = userGroups
+	return nil
+}
+
+// Groups returns the groups the request user belongs to according to the group file
+func (r *fileGroupResolver) Groups(req *authorization.Request) []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.userGroups[req.User]
+}
+
+// certGroupResolver resolves user groups from the organizational unit (OU) and organization (O)
+// fields of the request TLS client certificate
+type certGroupResolver struct{}
+
+// NewCertGroupResolver creates a new group resolver that resolves user groups from the request TLS client certificate
+func NewCertGroupResolver() core.GroupResolver {
+	return &certGroupResolver{}
+}
+
+// Init initialize the resolver
+func (r *certGroupResolver) Init() error {
+	return nil
+}
+
+// Groups returns the organizational units and organizations of the request client certificate
+func (r *certGroupResolver) Groups(req *authorization.Request) []string {
+	if len(req.RequestPeerCertificates) == 0 || req.RequestPeerCertificates[0] == nil {
+		return nil
+	}
+
+	subject := req.RequestPeerCertificates[0].Subject
+	var groups []string
+	groups = append(groups, subject.OrganizationalUnit...)
+	groups = append(groups, subject.Organization...)
+	return groups
+}
+
+// multiGroupResolver resolves user groups from multiple group resolvers
+type multiGroupResolver struct {
+	resolvers []core.GroupResolver
+}
+
+// NewMultiGroupResolver creates a new group resolver that returns the groups resolved by all the given resolvers
+func NewMultiGroupResolver(resolvers ...core.GroupResolver) core.GroupResolver {
+	return &multiGroupResolver{resolvers: resolvers}
+}
+
+// Init initialize all the resolvers
+func (r *multiGroupResolver) Init() error {
+	for _, resolver := range r.resolvers {
+		if err := resolver.Init(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Groups returns the union of the groups returned by all the resolvers
+func (r *multiGroupResolver) Groups(req *authorization.Request) []string {
+	var groups []string
+	seen := make(map[string]bool)
+	for _, resolver := range r.resolvers {
+		for _, group := range resolver.Groups(req) {
+			if !seen[group] {
+				seen[group] = true
+				groups = append(groups, group)
+			}
+		}
+	}
+	return groups
+}
@@ -0,0 +1,222 @@
+package authz
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+	"github.com/twistlock/authz/core"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileGroupResolver(t *testing.T) {
+
+	files := map[string]string{
+		"/tmp/groups.json": `{"ops":["alice","bob"],"dev":["alice"]}`,
+		"/tmp/groups.yaml": "ops:\n  - alice\n  - bob\ndev:\n  - alice\n",
+	}
+
+	for groupFileName, groups := range files {
+		err := ioutil.WriteFile(groupFileName, []byte(groups), 0755)
+		assert.NoError(t, err)
+
+		resolver := NewFileGroupResolver(&FileGroupResolverSettings{GroupPath: groupFileName})
+		assert.NoError(t, resolver.Init(), "Initialization must be succesfull")
+		assert.Equal(t, []string{"dev", "ops"}, resolver.Groups(&authorization.Request{User: "alice"}), groupFileName)
+		assert.Equal(t, []string{"ops"}, resolver.Groups(&authorization.Request{User: "bob"}), groupFileName)
+		assert.Empty(t, resolver.Groups(&authorization.Request{User: "carol"}), groupFileName)
+	}
+
+	const invalidGroupFileName = "/tmp/groups_invalid.json"
+	err := ioutil.WriteFile(invalidGroupFileName, []byte(`["ops"]`), 0755)
+	assert.NoError(t, err)
+	assert.Error(t, NewFileGroupResolver(&FileGroupResolverSettings{GroupPath: invalidGroupFileName}).Init(), "Invalid group file must fail")
+}
+
+func TestCertGroupResolver(t *testing.T) {
+
+	cert := newTestCertificate(t, pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"ops"}, Organization: []string{"acme"}})
+	resolver := NewMultiGroupResolver(NewCertGroupResolver(), NewCertGroupResolver())
+	assert.NoError(t, resolver.Init())
+	assert.Equal(t, []string{"ops", "acme"}, resolver.Groups(&authorization.Request{User: "alice", RequestPeerCertificates: []*authorization.PeerCertificate{cert}}))
+	assert.Empty(t, resolver.Groups(&authorization.Request{User: "alice"}), "Groups must be empty without client certificate")
+}
+
+func TestGroupPolicyApply(t *testing.T) {
+
+	policy := `{"name":"ops","groups":["ops"],"actions":["container"]}
+	           {"name":"acme","groups":["acme"],"actions":["docker_version"]}`
+
+	const policyFileName = "/tmp/policy_groups.json"
+	err := ioutil.WriteFile(policyFileName, []byte(policy), 0755)
+	assert.NoError(t, err)
+
+	const groupFileName = "/tmp/groups_policy.json"
+	err = ioutil.WriteFile(groupFileName, []byte(`{"ops":["alice"]}`), 0755)
+	assert.NoError(t, err)
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{
+		PolicyPath: policyFileName,
+		GroupResolver: NewMultiGroupResolver(
+			NewFileGroupResolver(&FileGroupResolverSettings{GroupPath: groupFileName}),
+			NewCertGroupResolver()),
+	})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	cert := newTestCertificate(t, pkix.Name{CommonName: "bob", Organization: []string{"acme"}})
+
+	tests := []struct {
+		uri   string
+		user  string
+		certs []*authorization.PeerCertificate
+		allow bool
+	}{
+		{"/v1.21/containers/json", "alice", nil, true},                                   // Group from group file
+		{"/v1.21/containers/json", "bob", []*authorization.PeerCertificate{cert}, false}, // Group not allowed
+		{"/v1.21/version", "bob", []*authorization.PeerCertificate{cert}, true},          // Group from certificate
+		{"/v1.21/version", "bob", nil, false},                                            // No groups
+	}
+
+	for _, test := range tests {
+		res := authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodGet, RequestURI: test.uri, User: test.user, RequestPeerCertificates: test.certs})
+		assert.Equal(t, test.allow, res.Allow, "Request %s by %s must be allowed/denied based on policy", test.uri, test.user)
+	}
+}
+
+func TestPrincipalPolicyApply(t *testing.T) {
+
+	policy := `{"name":"ops","principals":{"uri":["spiffe://corp/role/ops"]},"actions":["container"]}
+	           {"name":"acme","principals":{"email":["*@acme.io"]},"actions":["docker_version"]}`
+
+	const policyFileName = "/tmp/policy_principals.json"
+	err := ioutil.WriteFile(policyFileName, []byte(policy), 0755)
+	assert.NoError(t, err)
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyFileName})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	spiffe, _ := url.Parse("spiffe://corp/role/ops")
+	opsCert := newTestCertificate(t, pkix.Name{CommonName: "alice"})
+	opsCert.URIs = []*url.URL{spiffe}
+	acmeCert := newTestCertificate(t, pkix.Name{CommonName: "bob"})
+	acmeCert.EmailAddresses = []string{"bob@acme.io"}
+
+	tests := []struct {
+		uri   string
+		cert  *authorization.PeerCertificate
+		allow bool
+	}{
+		{"/v1.21/containers/json", opsCert, true},   // Certificate URI matches policy
+		{"/v1.21/version", opsCert, false},          // Certificate URI does not match policy
+		{"/v1.21/version", acmeCert, true},          // Certificate email matches policy
+		{"/v1.21/containers/json", acmeCert, false}, // Certificate email does not match policy
+	}
+
+	for _, test := range tests {
+		res := authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodGet, RequestURI: test.uri, User: test.cert.Subject.CommonName,
+			RequestPeerCertificates: []*authorization.PeerCertificate{test.cert}})
+		assert.Equal(t, test.allow, res.Allow, "Request %s by %s must be allowed/denied based on policy", test.uri, test.cert.Subject.CommonName)
+	}
+}
+
+func TestIssuerPolicyApply(t *testing.T) {
+
+	corpCA, corpKey := newTestIssuedCertificate(t, pkix.Name{CommonName: "corp"}, true, nil, nil)
+	teamCA, teamKey := newTestIssuedCertificate(t, pkix.Name{CommonName: "team"}, true, corpCA, corpKey)
+	rogueCA, rogueKey := newTestIssuedCertificate(t, pkix.Name{CommonName: "corp"}, true, nil, nil)
+	unknownCA, unknownKey := newTestIssuedCertificate(t, pkix.Name{CommonName: "unknown"}, true, nil, nil)
+
+	corpAlice, _ := newTestIssuedCertificate(t, pkix.Name{CommonName: "alice"}, false, corpCA, corpKey)
+	teamAlice, _ := newTestIssuedCertificate(t, pkix.Name{CommonName: "alice"}, false, teamCA, teamKey)
+	rogueAlice, _ := newTestIssuedCertificate(t, pkix.Name{CommonName: "alice"}, false, rogueCA, rogueKey)
+	unknownAlice, _ := newTestIssuedCertificate(t, pkix.Name{CommonName: "alice"}, false, unknownCA, unknownKey)
+
+	// The CA file contains the corporate root CA, which clients do not send
+	const caFileName = "/tmp/issuer_ca_policy.pem"
+	err := ioutil.WriteFile(caFileName, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: corpCA.Raw}), 0644)
+	assert.NoError(t, err)
+
+	policy := fmt.Sprintf(`{"name":"admins","users":["alice"],"issuers":["%s"],"actions":["container"]}
+	                       {"name":"users","users":["alice"],"actions":["docker_version"]}`, strings.ToUpper(core.CertificateFingerprint(teamCA)))
+
+	const policyFileName = "/tmp/policy_issuers.json"
+	err = ioutil.WriteFile(policyFileName, []byte(policy), 0755)
+	assert.NoError(t, err)
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{
+		PolicyPath:     policyFileName,
+		TrustedIssuers: []string{core.CertificateFingerprint(corpCA)},
+		IssuerCAPath:   caFileName,
+	})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	tests := []struct {
+		uri   string
+		certs []*x509.Certificate
+		allow bool
+	}{
+		{"/v1.21/version", []*x509.Certificate{corpAlice}, true},                    // Issued by the trusted root CA file
+		{"/v1.21/containers/json", []*x509.Certificate{corpAlice}, false},           // Policy issuer does not match
+		{"/v1.21/containers/json", []*x509.Certificate{teamAlice, teamCA}, true},    // Issued by the policy issuer
+		{"/v1.21/version", []*x509.Certificate{teamAlice}, false},                   // Intermediate not sent, chain to trusted issuer is not verified
+		{"/v1.21/version", []*x509.Certificate{rogueAlice, rogueCA}, false},         // Issuer with the same subject as the trusted issuer
+		{"/v1.21/version", []*x509.Certificate{rogueAlice, rogueCA, corpCA}, false}, // Trusted issuer sent but did not issue the certificate
+		{"/v1.21/version", []*x509.Certificate{unknownAlice, unknownCA}, false},     // Untrusted issuer
+		{"/v1.21/version", nil, false},                                              // No client certificate
+	}
+
+	for i, test := range tests {
+		var certs []*authorization.PeerCertificate
+		for _, cert := range test.certs {
+			certs = append(certs, (*authorization.PeerCertificate)(cert))
+		}
+		res := authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodGet, RequestURI: test.uri, User: "alice", RequestPeerCertificates: certs})
+		assert.Equal(t, test.allow, res.Allow, "Request %d %s must be allowed/denied based on issuer", i, test.uri)
+	}
+}
+
+// newTestCertificate creates a new self signed client certificate with the given subject
+func newTestCertificate(t *testing.T, subject pkix.Name) *authorization.PeerCertificate {
+	cert, _ := newTestIssuedCertificate(t, subject, false, nil, nil)
+	return (*authorization.PeerCertificate)(cert)
+}
+
+// newTestIssuedCertificate creates a new client or CA certificate with the given subject, signed by the given issuer (self signed if issuer is nil)
+func newTestIssuedCertificate(t assert.TestingT, subject pkix.Name, isCA bool, issuer *x509.Certificate, issuerKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               subject,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	if issuer == nil {
+		issuer, issuerKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert, key
+}
@@ -0,0 +1,115 @@
+package authz
+
+import (
+	"fmt"
+	"github.com/twistlock/authz/core"
+	"strings"
+)
+
+// ImagePolicy restricts the images that can be used to run containers and services, and the repositories images can be pulled from, pushed to,
+// tagged, committed or built into. Images are matched after normalization, e.g., busybox is matched as docker.io/library/busybox
+type ImagePolicy struct {
+	Registries    []string `json:"registries"`     // Registries are the allowed registry host patterns (e.g., registry.local:5000)
+	Repositories  []string `json:"repositories"`   // Repositories are the allowed repository patterns, including the registry (e.g., registry.local/ci/*)
+	RequireDigest bool     `json:"require_digest"` // RequireDigest requires digest pinned references when running containers and pulling images
+	// AllowLoad allows image_load, which is denied otherwise since the loaded images are tagged by the archive, which cannot be validated
+	AllowLoad bool `json:"allow_load"`
+
+	patternSet // patternSet holds the compiled policy patterns, set when the policy is validated
+}
+
+// validateImageRequest validates the images referred by the request against the image policy
+func validateImageRequest(policy *ImagePolicy, route *core.RouteInfo, body []byte) error {
+	switch route.Action {
+	case core.ActionContainerCreate:
+		config, err := decodeContainerCreate(body)
+		if err != nil {
+			return err
+		}
+		if config.Config == nil || config.Image == "" {
+			return fmt.Errorf("image is missing in container configuration")
+		}
+		return validateLocalImage(policy, config.Image, policy.RequireDigest)
+	case core.ActionServiceCreate, core.ActionServiceUpdate:
+		spec, err := decodeServiceSpec(body)
+		if err != nil {
+			return err
+		}
+		if spec.TaskTemplate.ContainerSpec == nil || spec.TaskTemplate.ContainerSpec.Image == "" {
+			return fmt.Errorf("image is missing in service specification")
+		}
+		return validateLocalImage(policy, spec.TaskTemplate.ContainerSpec.Image, policy.RequireDigest)
+	case core.ActionImageCreate:
+		if from := route.Query.Get("fromImage"); from != "" {
+			return validateImage(policy, joinReference(from, route.Query.Get("tag")), policy.RequireDigest)
+		}
+		// Image import, the repository is the name of the imported image
+		if repo := route.Query.Get("repo"); repo != "" {
+			return validateImage(policy, joinReference(repo, route.Query.Get("tag")), false)
+		}
+	case core.ActionImagePush:
+		return validateImage(policy, joinReference(route.ResourceID, route.Query.Get("tag")), false)
+	case core.ActionImageTag:
+		// Both source and target are validated, otherwise any image can be tagged into an allowed repository
+		if err := validateLocalImage(policy, route.ResourceID, false); err != nil {
+			return err
+		}
+		return validateImage(policy, joinReference(route.Query.Get("repo"), route.Query.Get("tag")), false)
+	case core.ActionContainerCommit:
+		// Images committed without a repository are untagged
+		if repo := route.Query.Get("repo"); repo != "" {
+			return validateImage(policy, joinReference(repo, route.Query.Get("tag")), false)
+		}
+	case core.ActionImageLoad:
+		if !policy.AllowLoad {
+			return fmt.Errorf("loading images is not allowed")
+		}
+	case core.ActionImageBuild:
+		// Multiple tags can be applied to the built image
+		for _, tag := range route.Query["t"] {
+			if err := validateImage(policy, tag, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateLocalImage validates a reference to an image that docker daemon resolves locally (e.g., the image of a created container).
+// References that can be image ids or id prefixes (e.g., db12ab34 or sha256:db12) are resolved by id, so they cannot be verified
+func validateLocalImage(policy *ImagePolicy, ref string, requireDigest bool) error {
+	if idReference.MatchString(ref) {
+		return fmt.Errorf("image '%s' is not allowed: image ids cannot be verified", ref)
+	}
+	return validateImage(policy, ref, requireDigest)
+}
+
+// validateImage validates a single image reference against the image policy
+func validateImage(policy *ImagePolicy, ref string, requireDigest bool) error {
+	image, err := core.ParseImageReference(ref)
+	if err != nil {
+		return fmt.Errorf("image '%s' is not allowed: %s", ref, err.Error())
+	}
+
+	if len(policy.Registries) > 0 && !policy.matchAny(policy.Registries, image.Registry) {
+		return fmt.Errorf("image '%s' is not allowed: registry '%s' is not allowed", ref, image.Registry)
+	}
+	if len(policy.Repositories) > 0 && !policy.matchAny(policy.Repositories, image.Name()) {
+		return fmt.Errorf("image '%s' is not allowed: repository '%s' is not allowed", ref, image.Name())
+	}
+	if requireDigest && image.Digest == "" {
+		return fmt.Errorf("image '%s' is not allowed: reference must be pinned by digest", ref)
+	}
+	return nil
+}
+
+// joinReference joins an image name and a tag or digest query parameter into a single reference
+func joinReference(name, tag string) string {
+	if tag == "" {
+		return name
+	}
+	if strings.Contains(tag, ":") {
+		return name + "@" + tag
+	}
+	return name + ":" + tag
+}
@@ -0,0 +1,70 @@
+package authz
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/twistlock/authz/core"
+	"net/http"
+	"testing"
+)
+
+func TestValidateImageRequest(t *testing.T) {
+
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	policy := &ImagePolicy{
+		Registries:   []string{"registry.local", "docker.io"},
+		Repositories: []string{"registry.local/ci/*", "docker.io/library/*"},
+	}
+	pinnedPolicy := &ImagePolicy{Registries: []string{"registry.local"}, RequireDigest: true}
+	loadPolicy := &ImagePolicy{Registries: []string{"registry.local"}, AllowLoad: true}
+
+	tests := []struct {
+		policy *ImagePolicy
+		method string
+		uri    string
+		body   string
+		allow  bool
+	}{
+		{policy, http.MethodPost, "/v1.21/containers/create", `{"Image":"busybox"}`, true},
+		{policy, http.MethodPost, "/v1.21/containers/create", `{"Image":"registry.local/ci/app:v1"}`, true},
+		{policy, http.MethodPost, "/v1.21/containers/create", `{"Image":"registry.local/prod/app:v1"}`, false}, // Repository not allowed
+		{policy, http.MethodPost, "/v1.21/containers/create", `{"Image":"evil.io/ci/app"}`, false},             // Registry not allowed
+		{policy, http.MethodPost, "/v1.21/containers/create", `{"Image":"` + digest[7:] + `"}`, false},         // Image id cannot be verified
+		{policy, http.MethodPost, "/v1.21/containers/create", `{"Image":"db12ab34"}`, false},                   // Image id prefix cannot be verified
+		{policy, http.MethodPost, "/v1.21/containers/create", `{"Image":"sha256:db12"}`, false},                // Image id prefix cannot be verified
+		{policy, http.MethodPost, "/v1.21/containers/create", `{"HostConfig":{}}`, false},                      // Image is missing
+		{policy, http.MethodPost, "/v1.21/services/create", `{"TaskTemplate":{"ContainerSpec":{"Image":"db12ab34"}}}`, false},
+		{policy, http.MethodPost, "/v1.21/services/create", `{"TaskTemplate":{"ContainerSpec":{"Image":"busybox"}}}`, true},
+		{policy, http.MethodPost, "/v1.21/images/create?fromImage=registry.local/ci/app&tag=v1", "", true},      // Pull
+		{policy, http.MethodPost, "/v1.21/images/create?fromImage=evil.io/app&tag=v1", "", false},               // Pull from unknown registry
+		{policy, http.MethodPost, "/v1.21/images/create?fromSrc=-&repo=registry.local/ci/app", "", true},        // Import into allowed repository
+		{policy, http.MethodPost, "/v1.21/images/registry.local/ci/app/push?tag=v1", "", true},                  // Push to allowed repository
+		{policy, http.MethodPost, "/v1.21/images/evil.io/app/push", "", false},                                  // Push to unknown registry
+		{policy, http.MethodPost, "/v1.21/images/registry.local/ci/app:v1/tag?repo=busybox&tag=v1", "", true},   // Tag between allowed repositories
+		{policy, http.MethodPost, "/v1.21/images/evil.io/app/tag?repo=registry.local/ci/app&tag=v1", "", false}, // Tag unknown image into allowed repository
+		{policy, http.MethodPost, "/v1.21/images/registry.local/ci/app/tag?repo=evil.io/app", "", false},        // Tag into unknown repository
+		{policy, http.MethodPost, "/v1.21/images/db12ab34/tag?repo=registry.local/ci/app", "", false},           // Tag image id prefix
+		{policy, http.MethodPost, "/v1.21/images/sha256:db12/tag?repo=registry.local/ci/app", "", false},        // Tag image id prefix
+		{policy, http.MethodPost, "/v1.39/build?t=registry.local/ci/app:v1&t=busybox:ci", "", true},             // Build tags in allowed repositories
+		{policy, http.MethodPost, "/v1.39/build?t=registry.local/ci/app:v1&t=evil.io/app", "", false},           // Build tag in unknown repository
+		{policy, http.MethodPost, "/v1.39/build", "", true},                                                     // Untagged build
+		{policy, http.MethodPost, "/v1.21/commit?container=x&repo=registry.local/ci/app&tag=v2", "", true},      // Commit into allowed repository
+		{policy, http.MethodPost, "/v1.21/commit?container=x&repo=evil.io/app&tag=v2", "", false},               // Commit into unknown registry
+		{policy, http.MethodPost, "/v1.21/commit?container=x&repo=registry.local/prod/app", "", false},          // Commit into unknown repository
+		{policy, http.MethodPost, "/v1.21/commit?container=x", "", true},                                        // Untagged commit
+		{policy, http.MethodPost, "/v1.21/images/load", "", false},                                              // Loaded image tags cannot be validated
+		{loadPolicy, http.MethodPost, "/v1.21/images/load", "", true},                                           // Load explicitly allowed
+		{pinnedPolicy, http.MethodPost, "/v1.21/containers/create", `{"Image":"registry.local/app:v1"}`, false}, // Tag reference is not pinned
+		{pinnedPolicy, http.MethodPost, "/v1.21/containers/create", `{"Image":"registry.local/app@` + digest + `"}`, true},
+		{pinnedPolicy, http.MethodPost, "/v1.21/images/create?fromImage=registry.local/app&tag=" + digest, "", true},
+		{pinnedPolicy, http.MethodPost, "/v1.21/images/create?fromImage=registry.local/app&tag=v1", "", false},
+		{pinnedPolicy, http.MethodPost, "/v1.21/images/registry.local/app/push?tag=v1", "", true}, // Digest is not required for push
+	}
+
+	for _, test := range tests {
+		route, err := core.ParseRequest(test.method, test.uri)
+		assert.NoError(t, err)
+		err = validateImageRequest(test.policy, route, []byte(test.body))
+		assert.Equal(t, test.allow, err == nil, "Request %s %s %s must be allowed/denied based on policy (%v)", test.method, test.uri, test.body, err)
+	}
+}
@@ -0,0 +1,99 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+// defaultNetworkDrivers are the network drivers that can be used if the network policy does not specify drivers
+var defaultNetworkDrivers = []string{"bridge", "overlay"}
+
+// NetworkPolicy restricts the driver, the subnets and the driver options of the networks that can be created in network_create
+type NetworkPolicy struct {
+	Drivers []string `json:"drivers"` // Drivers are the network driver patterns that can be used (only bridge and overlay if empty)
+	Subnets []string `json:"subnets"` // Subnets are the CIDRs that contain the subnets that can be configured (e.g., 10.10.0.0/16)
+	Options []string `json:"options"` // Options are the driver option name patterns that can be set (e.g., com.docker.network.bridge.enable_icc)
+
+	patternSet // patternSet holds the compiled policy patterns, set when the policy is validated
+}
+
+// networkCreateConfig is the network create request body
+type networkCreateConfig struct {
+	Name    string            `json:"Name"`
+	Driver  string            `json:"Driver"`
+	Options map[string]string `json:"Options"`
+	IPAM    *struct {
+		Config []struct {
+			Subnet  string `json:"Subnet"`
+			IPRange string `json:"IPRange"`
+			Gateway string `json:"Gateway"`
+		} `json:"Config"`
+	} `json:"IPAM"`
+}
+
+// validateNetworkCreate validates the network create request body against the network policy
+func validateNetworkCreate(policy *NetworkPolicy, body []byte) error {
+	if len(body) == 0 {
+		return fmt.Errorf("network configuration is missing in request body")
+	}
+
+	var config networkCreateConfig
+	if err := json.Unmarshal(body, &config); err != nil {
+		return fmt.Errorf("invalid network configuration: %s", err.Error())
+	}
+
+	driver := config.Driver
+	if driver == "" {
+		driver = "bridge"
+	}
+	drivers := policy.Drivers
+	if len(drivers) == 0 {
+		drivers = defaultNetworkDrivers
+	}
+	if !policy.matchAny(drivers, driver) {
+		return fmt.Errorf("network driver '%s' is not allowed", driver)
+	}
+
+	for option := range config.Options {
+		if !policy.matchAny(policy.Options, option) {
+			return fmt.Errorf("network option '%s' is not allowed", option)
+		}
+	}
+
+	if config.IPAM == nil {
+		return nil
+	}
+	for _, ipamConfig := range config.IPAM.Config {
+		for _, subnet := range []string{ipamConfig.Subnet, ipamConfig.IPRange} {
+			if subnet == "" {
+				continue
+			}
+			if err := validateSubnet(policy, subnet); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateSubnet validates the subnet is contained in any of the policy subnets
+func validateSubnet(policy *NetworkPolicy, subnet string) error {
+	_, requested, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return fmt.Errorf("invalid subnet '%s'", subnet)
+	}
+
+	requestedOnes, requestedBits := requested.Mask.Size()
+	for _, policySubnet := range policy.Subnets {
+		_, allowed, err := net.ParseCIDR(policySubnet)
+		if err != nil {
+			continue
+		}
+		allowedOnes, allowedBits := allowed.Mask.Size()
+		if allowedBits == requestedBits && allowedOnes <= requestedOnes && allowed.Contains(requested.IP) {
+			return nil
+		}
+	}
+	return fmt.Errorf("subnet '%s' is not allowed", subnet)
+}
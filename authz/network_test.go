@@ -0,0 +1,75 @@
+package authz
+
+import (
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestValidateNetworkCreate(t *testing.T) {
+
+	policy := &NetworkPolicy{
+		Subnets: []string{"10.10.0.0/16", "fd00:10::/32"},
+		Options: []string{"com.docker.network.bridge.enable_icc"},
+	}
+
+	tests := []struct {
+		body           string
+		expectedReason string // expectedReason is the expected denial reason, empty if the request is allowed
+	}{
+		{`{"Name":"app"}`, ""},
+		{`{"Name":"app","Driver":"overlay"}`, ""},
+		{`{"Name":"app","Driver":"macvlan","Options":{"parent":"eth0"}}`, "network driver 'macvlan' is not allowed"},
+		{`{"Name":"app","Driver":"ipvlan"}`, "network driver 'ipvlan' is not allowed"},
+		{`{"Name":"app","Options":{"com.docker.network.bridge.enable_icc":"false"}}`, ""},
+		{`{"Name":"app","Options":{"com.docker.network.bridge.name":"docker0"}}`, "network option 'com.docker.network.bridge.name' is not allowed"},
+		{`{"Name":"app","IPAM":{"Config":[{"Subnet":"10.10.1.0/24","IPRange":"10.10.1.128/25","Gateway":"10.10.1.1"}]}}`, ""},
+		{`{"Name":"app","IPAM":{"Config":[{"Subnet":"10.10.0.0/16"}]}}`, ""},
+		{`{"Name":"app","IPAM":{"Config":[{"Subnet":"10.0.0.0/8"}]}}`, "subnet '10.0.0.0/8' is not allowed"},
+		{`{"Name":"app","IPAM":{"Config":[{"Subnet":"192.168.1.0/24"}]}}`, "subnet '192.168.1.0/24' is not allowed"},
+		{`{"Name":"app","IPAM":{"Config":[{"Subnet":"fd00:10:1::/48"}]}}`, ""},
+		{`{"Name":"app","IPAM":{"Config":[{"Subnet":"::ffff:10.10.1.0/120"}]}}`, "subnet '::ffff:10.10.1.0/120' is not allowed"},
+		{`{"Name":"app","IPAM":{"Config":[{"Subnet":"10.10.1.0"}]}}`, "invalid subnet '10.10.1.0'"},
+		{``, "network configuration is missing in request body"},
+	}
+
+	for _, test := range tests {
+		err := validateNetworkCreate(policy, []byte(test.body))
+		if test.expectedReason == "" {
+			assert.NoError(t, err, test.body)
+		} else if assert.Error(t, err, test.body) {
+			assert.Equal(t, test.expectedReason, err.Error(), test.body)
+		}
+	}
+}
+
+func TestVolumeNetworkPolicyApply(t *testing.T) {
+
+	policy := `{"name":"users","users":["alice"],"actions":["volume_create","network_create","container_create"],"volume":{},"network":{"subnets":["10.10.0.0/16"]}}`
+
+	const policyFileName = "/tmp/policy_volume_network.json"
+	err := ioutil.WriteFile(policyFileName, []byte(policy), 0755)
+	assert.NoError(t, err)
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyFileName})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	tests := []struct {
+		uri   string
+		body  string
+		allow bool
+	}{
+		{"/v1.39/volumes/create", `{"Name":"data"}`, true},
+		{"/v1.39/volumes/create", `{"Name":"etc","DriverOpts":{"type":"none","o":"bind","device":"/etc"}}`, false},
+		{"/v1.39/networks/create", `{"Name":"app","IPAM":{"Config":[{"Subnet":"10.10.1.0/24"}]}}`, true},
+		{"/v1.39/networks/create", `{"Name":"app","Driver":"macvlan"}`, false},
+		{"/v1.39/containers/create", `{"Image":"busybox","HostConfig":{"Mounts":[{"Type":"volume","Target":"/etc","VolumeOptions":{"DriverConfig":{"Options":{"o":"bind","device":"/etc"}}}}]}}`, false},
+	}
+
+	for _, test := range tests {
+		res := authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: test.uri, User: "alice", RequestBody: []byte(test.body)})
+		assert.Equal(t, test.allow, res.Allow, "Request %s %s must be allowed/denied based on policy: %s", test.uri, test.body, res.Msg)
+	}
+}
@@ -0,0 +1,372 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/twistlock/authz/core"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// OwnerUser restricts container actions to the user that created the container
+	OwnerUser = "user"
+
+	// OwnerGroup restricts container actions to the users that share a group with the user that created the container
+	OwnerGroup = "group"
+)
+
+// containerOwner is the owner of a single container
+type containerOwner struct {
+	ID     string   `json:"id"`     // ID is the container id
+	Names  []string `json:"names"`  // Names are the container names
+	Owner  string   `json:"owner"`  // Owner is the user that created the container
+	Groups []string `json:"groups"` // Groups are the owner groups when the container was created
+}
+
+// ownershipStore tracks the owners of containers. Owners are learned from container create responses,
+// and rebuilt from the policies owner labels in container list and inspect responses (e.g., after the store is lost).
+// The store is persisted to a local file, if configured, so ownership survives broker restarts
+type ownershipStore struct {
+	path   string                     // path is the ownership file path (in memory only if empty)
+	lock   sync.RWMutex               // lock protects owners
+	owners map[string]*containerOwner // owners maps each container id to its owner
+}
+
+// newOwnershipStore creates a new ownership store persisted to the given path
+func newOwnershipStore(path string) *ownershipStore {
+	return &ownershipStore{path: path, owners: make(map[string]*containerOwner)}
+}
+
+// load loads the ownership file, a missing file is an empty store
+func (s *ownershipStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var owners []*containerOwner
+	if err := json.Unmarshal(data, &owners); err != nil {
+		return fmt.Errorf("failed to parse ownership file %q: %s", s.path, err.Error())
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, owner := range owners {
+		s.owners[owner.ID] = owner
+	}
+	logrus.Infof("Loaded '%d' container owners", len(owners))
+	return nil
+}
+
+// save persists the store, must be called with the lock held
+func (s *ownershipStore) save() {
+	if s.path == "" {
+		return
+	}
+
+	var owners []*containerOwner
+	for _, owner := range s.owners {
+		owners = append(owners, owner)
+	}
+	data, err := json.Marshal(owners)
+	if err != nil {
+		logrus.Errorf("Failed to marshal container owners %q", err.Error())
+		return
+	}
+
+	// Write to a temporary file first, so a crash does not leave a partial ownership file
+	os.MkdirAll(filepath.Dir(s.path), 0700)
+	tmpPath := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		logrus.Errorf("Failed to save container owners %q", err.Error())
+		return
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		logrus.Errorf("Failed to save container owners %q", err.Error())
+	}
+}
+
+// lookup returns the owner of the container referred by id, id prefix or name (nil if unknown)
+func (s *ownershipStore) lookup(ref string) *containerOwner {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.find(ref)
+}
+
+// find returns the owner of the container referred by id, id prefix or name, must be called with the lock held
+func (s *ownershipStore) find(ref string) *containerOwner {
+	ref = strings.TrimPrefix(ref, "/")
+	if ref == "" {
+		return nil
+	}
+	if owner, ok := s.owners[ref]; ok {
+		return owner
+	}
+
+	// Same resolution as docker daemon, names take precedence over id prefixes, which must be unique.
+	// Names are unique as well, an ambiguous name (e.g., in an ownership file of an earlier version) is unknown
+	var named, matches []*containerOwner
+	for _, owner := range s.owners {
+		for _, name := range owner.Names {
+			if name == ref {
+				named = append(named, owner)
+			}
+		}
+		if strings.HasPrefix(owner.ID, ref) {
+			matches = append(matches, owner)
+		}
+	}
+	if len(named) > 0 {
+		matches = named
+	}
+	if len(matches) != 1 {
+		return nil
+	}
+	return matches[0]
+}
+
+// add records the owner of a container, an already known owner is kept unless replace is set
+func (s *ownershipStore) add(owner *containerOwner, replace bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.owners[owner.ID]; ok && !replace {
+		return
+	}
+	s.release(owner.ID, owner.Names)
+	s.owners[owner.ID] = owner
+	s.save()
+}
+
+// updateNames records the current names of the container with the given id, as reported by docker daemon,
+// and returns whether the container is known
+func (s *ownershipStore) updateNames(id string, names []string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	owner, ok := s.owners[id]
+	if !ok {
+		return false
+	}
+	if len(names) == 0 || sameNames(owner.Names, names) {
+		return true
+	}
+	owner.Names = names
+	s.release(id, names)
+	s.save()
+	return true
+}
+
+// sameNames checks whether both name lists hold the same names, in the same order
+func sameNames(names, other []string) bool {
+	if len(names) != len(other) {
+		return false
+	}
+	for i := range names {
+		if names[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// release removes the containers other than id that hold any of the names, must be called with the lock held.
+// Docker only reuses a name after the container that held it is removed, e.g., a container run with --rm,
+// whose removal is not requested through the API
+func (s *ownershipStore) release(id string, names []string) {
+	released := make(map[string]bool)
+	for _, name := range names {
+		released[name] = true
+	}
+	for _, owner := range s.owners {
+		if owner.ID == id {
+			continue
+		}
+		for _, held := range owner.Names {
+			if released[held] {
+				delete(s.owners, owner.ID)
+				break
+			}
+		}
+	}
+}
+
+// prune removes the containers that are not in the given set of container ids, e.g., containers that were
+// removed when they died (--rm), must be called with a complete list of the existing containers
+func (s *ownershipStore) prune(ids map[string]bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pruned := false
+	for id := range s.owners {
+		if !ids[id] {
+			delete(s.owners, id)
+			pruned = true
+		}
+	}
+	if pruned {
+		s.save()
+	}
+}
+
+// remove removes the owner of a deleted container
+func (s *ownershipStore) remove(ref string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if owner := s.find(ref); owner != nil {
+		delete(s.owners, owner.ID)
+		s.save()
+	}
+}
+
+// rename updates the name of a renamed container
+func (s *ownershipStore) rename(ref, name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if owner := s.find(ref); owner != nil {
+		owner.Names = []string{strings.TrimPrefix(name, "/")}
+		s.release(owner.ID, owner.Names)
+		s.save()
+	}
+}
+
+// learnOwners updates the ownership store from container create, delete and rename responses, and from
+// the owner labels in container list and inspect responses. Containers that no longer exist (e.g., removed when they died)
+// are dropped when a request for them fails with not found, or when they are missing from a complete container list
+func (f *basicAuthorizer) learnOwners(authZReq *authorization.Request, route *core.RouteInfo, groups []string) {
+	switch {
+	case ownedAction(route) && authZReq.ResponseStatusCode == http.StatusNotFound:
+		f.owners.remove(route.ResourceID)
+	case route.Action == core.ActionContainerCreate && authZReq.ResponseStatusCode == http.StatusCreated:
+		var created struct {
+			ID string `json:"Id"`
+		}
+		if err := json.Unmarshal(authZReq.ResponseBody, &created); err != nil || created.ID == "" {
+			logrus.Errorf("Failed to learn owner of created container from response %q", string(authZReq.ResponseBody))
+			return
+		}
+		owner := &containerOwner{ID: created.ID, Owner: authZReq.User, Groups: groups}
+		if name := route.Query.Get("name"); name != "" {
+			owner.Names = []string{strings.TrimPrefix(name, "/")}
+		}
+		f.owners.add(owner, true)
+	case route.Action == core.ActionContainerDelete && authZReq.ResponseStatusCode == http.StatusNoContent:
+		f.owners.remove(route.ResourceID)
+	case route.Action == core.ActionContainerRename && authZReq.ResponseStatusCode == http.StatusNoContent:
+		f.owners.rename(route.ResourceID, route.Query.Get("name"))
+	case route.Action == core.ActionContainerList && authZReq.ResponseStatusCode == http.StatusOK:
+		objects, err := decodeListResponse(route.Action, authZReq.ResponseBody)
+		if err != nil {
+			return
+		}
+		if completeContainerList(route.Query) {
+			ids := make(map[string]bool)
+			for _, object := range objects {
+				ids[object.ids[len(object.ids)-1]] = true
+			}
+			f.owners.prune(ids)
+		}
+		for _, object := range objects {
+			f.learnLabeledOwner(object)
+		}
+	case route.Action == core.ActionContainerInspect && authZReq.ResponseStatusCode == http.StatusOK:
+		var container struct {
+			ID     string `json:"Id"`
+			Name   string `json:"Name"`
+			Config struct {
+				Labels map[string]string `json:"Labels"`
+			} `json:"Config"`
+		}
+		if err := json.Unmarshal(authZReq.ResponseBody, &container); err != nil || container.ID == "" {
+			return
+		}
+		f.learnLabeledOwner(listedObject{ids: []string{strings.TrimPrefix(container.Name, "/"), container.ID}, labels: container.Config.Labels})
+	}
+}
+
+// learnLabeledOwner records the owner of a container according to the policies owner labels, if the owner is not already known.
+// If the owner is known, the container names are updated instead, e.g., the name docker assigns to a container created without a name
+func (f *basicAuthorizer) learnLabeledOwner(object listedObject) {
+	id := object.ids[len(object.ids)-1]
+	if f.owners.updateNames(id, object.ids[:len(object.ids)-1]) {
+		return
+	}
+
+	for _, policy := range f.snapshot().policies {
+		user := object.labels[policy.OwnerLabel]
+		if policy.OwnerLabel == "" || user == "" {
+			continue
+		}
+
+		owner := &containerOwner{ID: id, Names: object.ids[:len(object.ids)-1], Owner: user}
+		if f.settings.GroupResolver != nil {
+			// Only the groups that can be resolved without the owner request (e.g., from the group file) are known
+			owner.Groups = f.settings.GroupResolver.Groups(&authorization.Request{User: user})
+		}
+		f.owners.add(owner, false)
+		return
+	}
+}
+
+// completeContainerList checks whether the container list query lists all the existing containers (all, without filters or limits)
+func completeContainerList(query url.Values) bool {
+	switch strings.ToLower(query.Get("all")) {
+	case "", "0", "no", "false", "none":
+		return false
+	}
+	for _, param := range []string{"filters", "limit", "since", "before"} {
+		if query.Get(param) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// validateOwner validates the request user is the container owner, or shares a group with the owner, according to the policy owner mode
+func validateOwner(mode string, route *core.RouteInfo, owner *containerOwner, user string, groups []string) error {
+	if owner == nil {
+		return fmt.Errorf("owner of container '%s' is unknown", route.ResourceID)
+	}
+	if owner.Owner == user {
+		return nil
+	}
+	if mode == OwnerGroup {
+		for _, group := range groups {
+			for _, ownerGroup := range owner.Groups {
+				if group == ownerGroup {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("container '%s' is owned by '%s'", route.ResourceID, owner.Owner)
+}
+
+// validateOwnerLabel validates the created container is labeled with the request user as owner
+func validateOwnerLabel(label string, user string, body []byte) error {
+	config, err := decodeContainerCreate(body)
+	if err != nil {
+		return err
+	}
+	if config.Config == nil || config.Labels[label] != user {
+		return fmt.Errorf("container must be labeled with %s=%s", label, user)
+	}
+	return nil
+}
+
+// ownedAction checks whether the request refers to a specific existing container, and can therefore be restricted to the container owner
+func ownedAction(route *core.RouteInfo) bool {
+	return route.Resource == core.ResourceContainer && route.ResourceID != "" && route.Action != core.ActionContainerCreate
+}
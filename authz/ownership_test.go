@@ -0,0 +1,183 @@
+package authz
+
+import (
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestOwnershipPolicy(t *testing.T) {
+
+	policy := `{"name":"users","users":["alice","bob"],"actions":["container"],"owner":"user","owner_label":"com.example.owner"}
+	           {"name":"ops","groups":["ops"],"actions":["container_logs"],"owner":"group"}`
+
+	const policyFileName = "/tmp/policy_ownership.json"
+	err := ioutil.WriteFile(policyFileName, []byte(policy), 0755)
+	assert.NoError(t, err)
+
+	const groupFileName = "/tmp/groups_ownership.json"
+	err = ioutil.WriteFile(groupFileName, []byte(`{"ops":["alice","carol"]}`), 0755)
+	assert.NoError(t, err)
+
+	const ownershipFileName = "/tmp/ownership.json"
+	os.Remove(ownershipFileName)
+
+	newAuthorizer := func() *basicAuthorizer {
+		authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{
+			PolicyPath:    policyFileName,
+			GroupResolver: NewFileGroupResolver(&FileGroupResolverSettings{GroupPath: groupFileName}),
+			OwnershipPath: ownershipFileName,
+		})
+		assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+		return authorizer.(*basicAuthorizer)
+	}
+	authorizer := newAuthorizer()
+
+	// Created containers must be labeled with the owner
+	res := authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: "/v1.39/containers/create?name=web", User: "alice",
+		RequestBody: []byte(`{"Image":"busybox"}`)})
+	assert.False(t, res.Allow, "Container without owner label must be denied")
+	res = authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: "/v1.39/containers/create?name=web", User: "alice",
+		RequestBody: []byte(`{"Image":"busybox","Labels":{"com.example.owner":"bob"}}`)})
+	assert.False(t, res.Allow, "Container labeled with another owner must be denied")
+	res = authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: "/v1.39/containers/create?name=web", User: "alice",
+		RequestBody: []byte(`{"Image":"busybox","Labels":{"com.example.owner":"alice"}}`)})
+	assert.True(t, res.Allow, res.Msg)
+
+	// Owner is learned from the create response
+	res = authorizer.AuthZRes(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: "/v1.39/containers/create?name=web", User: "alice",
+		ResponseStatusCode: http.StatusCreated, ResponseBody: []byte(`{"Id":"0123456789ab","Warnings":null}`)})
+	assert.True(t, res.Allow, res.Msg)
+
+	// Owner of a container created before ownership was tracked is learned from its owner label
+	res = authorizer.AuthZRes(&authorization.Request{RequestMethod: http.MethodGet, RequestURI: "/v1.39/containers/db/json", User: "bob",
+		ResponseStatusCode: http.StatusOK, ResponseBody: []byte(`{"Id":"fedcba987654","Name":"/db","Config":{"Labels":{"com.example.owner":"bob"}}}`)})
+	assert.True(t, res.Allow, res.Msg)
+
+	tests := []struct {
+		method string
+		uri    string
+		user   string
+		allow  bool
+	}{
+		{http.MethodPost, "/v1.39/containers/web/stop", "alice", true},   // Owner by name
+		{http.MethodPost, "/v1.39/containers/0123/exec", "alice", true},  // Owner by id prefix
+		{http.MethodPost, "/v1.39/containers/web/stop", "bob", false},    // Not owner
+		{http.MethodGet, "/v1.39/containers/web/logs", "carol", true},    // Owner group
+		{http.MethodPost, "/v1.39/containers/web/stop", "carol", false},  // Owner group policy does not allow action
+		{http.MethodGet, "/v1.39/containers/db/logs", "carol", false},    // Owner not in group
+		{http.MethodDelete, "/v1.39/containers/db", "bob", true},         // Owner learned from labels
+		{http.MethodDelete, "/v1.39/containers/unknown", "alice", false}, // Unknown owner
+		{http.MethodGet, "/v1.39/containers/json", "bob", true},          // Not a specific container
+	}
+
+	check := func(authorizer *basicAuthorizer) {
+		for _, test := range tests {
+			res := authorizer.AuthZReq(&authorization.Request{RequestMethod: test.method, RequestURI: test.uri, User: test.user})
+			assert.Equal(t, test.allow, res.Allow, "Request %s %s by %s must be allowed/denied based on owner: %s", test.method, test.uri, test.user, res.Msg)
+		}
+	}
+	check(authorizer)
+
+	// Ownership survives restarts
+	check(newAuthorizer())
+
+	// Owner is removed with the container
+	authorizer.AuthZRes(&authorization.Request{RequestMethod: http.MethodDelete, RequestURI: "/v1.39/containers/web", User: "alice", ResponseStatusCode: http.StatusNoContent})
+	res = authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: "/v1.39/containers/web/stop", User: "alice"})
+	assert.False(t, res.Allow, "Owner of deleted container must be unknown")
+}
+
+func TestOwnershipNameReuse(t *testing.T) {
+
+	policy := `{"name":"users","users":["alice","mallory"],"actions":["container_*"],"owner":"user"}`
+
+	const policyFileName = "/tmp/policy_ownership_reuse.json"
+	err := ioutil.WriteFile(policyFileName, []byte(policy), 0755)
+	assert.NoError(t, err)
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyFileName}).(*basicAuthorizer)
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	create := func(user, name, id string) {
+		res := authorizer.AuthZRes(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: "/v1.39/containers/create?name=" + name, User: user,
+			ResponseStatusCode: http.StatusCreated, ResponseBody: []byte(`{"Id":"` + id + `"}`)})
+		assert.True(t, res.Allow, res.Msg)
+	}
+	allowed := func(user, uri string) bool {
+		return authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: uri, User: user}).Allow
+	}
+
+	// A --rm container is removed without a delete request, and its name is reused by another user
+	create("alice", "web", "0123456789ab")
+	create("mallory", "web", "fedcba987654")
+	for i := 0; i < 50; i++ {
+		assert.True(t, allowed("mallory", "/v1.39/containers/web/stop"), "Reused name must resolve to the new container")
+		assert.False(t, allowed("alice", "/v1.39/containers/web/stop"), "Reused name must not resolve to the removed container")
+	}
+	assert.Nil(t, authorizer.owners.lookup("0123456789ab"), "Container whose name is reused must be removed")
+
+	// Renaming a container to the name of a removed container
+	create("alice", "db", "aaaaaaaaaaaa")
+	create("mallory", "cache", "bbbbbbbbbbbb")
+	authorizer.AuthZRes(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: "/v1.39/containers/cache/rename?name=db", User: "mallory",
+		ResponseStatusCode: http.StatusNoContent})
+	assert.True(t, allowed("mallory", "/v1.39/containers/db/stop"))
+	assert.False(t, allowed("alice", "/v1.39/containers/db/stop"))
+
+	// Containers that no longer exist are removed
+	create("alice", "tmp", "cccccccccccc")
+	authorizer.AuthZRes(&authorization.Request{RequestMethod: http.MethodGet, RequestURI: "/v1.39/containers/tmp/json", User: "alice",
+		ResponseStatusCode: http.StatusNotFound})
+	assert.Nil(t, authorizer.owners.lookup("tmp"), "Container not found must be removed")
+
+	create("alice", "batch", "dddddddddddd")
+	authorizer.AuthZRes(&authorization.Request{RequestMethod: http.MethodGet, RequestURI: "/v1.39/containers/json?all=1&filters={}", User: "alice",
+		ResponseStatusCode: http.StatusOK, ResponseBody: []byte(`[]`)})
+	assert.NotNil(t, authorizer.owners.lookup("batch"), "Filtered container list must not remove containers")
+	authorizer.AuthZRes(&authorization.Request{RequestMethod: http.MethodGet, RequestURI: "/v1.39/containers/json?all=1", User: "alice",
+		ResponseStatusCode: http.StatusOK, ResponseBody: []byte(`[{"Id":"fedcba987654","Names":["/web"]}]`)})
+	assert.Nil(t, authorizer.owners.lookup("batch"), "Container missing from the complete container list must be removed")
+	assert.NotNil(t, authorizer.owners.lookup("web"))
+}
+
+func TestOwnershipAssignedName(t *testing.T) {
+
+	policy := `{"name":"users","users":["alice","bob"],"actions":["container_*"],"owner":"user"}`
+
+	const policyFileName = "/tmp/policy_ownership_assigned.json"
+	err := ioutil.WriteFile(policyFileName, []byte(policy), 0755)
+	assert.NoError(t, err)
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyFileName}).(*basicAuthorizer)
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	stop := func(user, name string) *authorization.Response {
+		return authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: "/v1.39/containers/" + name + "/stop", User: user})
+	}
+
+	// Containers created without a name are named by docker daemon, the assigned name is learned from list and inspect responses
+	for _, create := range []struct {
+		id       string
+		name     string
+		response *authorization.Request
+	}{
+		{"0123456789ab", "eager_turing", &authorization.Request{RequestMethod: http.MethodGet, RequestURI: "/v1.39/containers/json", User: "bob",
+			ResponseStatusCode: http.StatusOK, ResponseBody: []byte(`[{"Id":"0123456789ab","Names":["/eager_turing"]}]`)}},
+		{"fedcba987654", "brave_hopper", &authorization.Request{RequestMethod: http.MethodGet, RequestURI: "/v1.39/containers/fedcba987654/json", User: "alice",
+			ResponseStatusCode: http.StatusOK, ResponseBody: []byte(`{"Id":"fedcba987654","Name":"/brave_hopper"}`)}},
+	} {
+		res := authorizer.AuthZRes(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: "/v1.39/containers/create", User: "alice",
+			ResponseStatusCode: http.StatusCreated, ResponseBody: []byte(`{"Id":"` + create.id + `"}`)})
+		assert.True(t, res.Allow, res.Msg)
+		assert.False(t, stop("alice", create.name).Allow, "Assigned name is unknown before it is reported")
+
+		authorizer.AuthZRes(create.response)
+		res = stop("alice", create.name)
+		assert.True(t, res.Allow, "Owner must be allowed by the assigned name: %s", res.Msg)
+		assert.False(t, stop("bob", create.name).Allow, "Other users must be denied by the assigned name")
+	}
+}
@@ -0,0 +1,593 @@
+package authz
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/Sirupsen/logrus"
+	"github.com/twistlock/authz/core"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// policyDocument is a policy file in YAML, TOML or JSON format (according to the file extension), e.g.,
+//
+//	include = ["base.toml"]
+//
+//	[[policies]]
+//	name = "ops"
+//	users = ["alice"]
+//	actions = ["container_*"]
+//
+// YAML and JSON documents can also be a list of policies, and JSON files can list one policy object per line.
+// Documents are converted to JSON, so policies have the same schema regardless of the file format.
+// Fields that are not part of the schema (e.g., misspelled fields) are rejected
+type policyDocument struct {
+	// Include are the paths (or glob patterns) of policy files whose policies are loaded before the document policies.
+	// Relative paths are relative to the document directory
+	Include  []string          `json:"include"`
+	Policies []json.RawMessage `json:"policies"` // Policies are the document policies
+}
+
+// policySnapshot is a loaded set of validated policies, indexed by user and group. Snapshots are never modified once published,
+// a reload publishes a new snapshot, so each request is evaluated against a single consistent set of policies
+type policySnapshot struct {
+	policies   []BasicPolicy
+	users      map[string][]int                         // users maps each user to the indexes of the policies that apply to the user
+	groups     map[string][]int                         // groups maps each group to the indexes of the policies that apply to the group
+	principals map[string]map[string][]principalPattern // principals maps each principal field and pattern literal prefix to the policy patterns
+}
+
+// principalPattern is a principal pattern of the policy with the given index
+type principalPattern struct {
+	policy  int
+	pattern string
+}
+
+// newPolicySnapshot indexes the validated policies by user and group, and the policies actions by docker action,
+// so evaluating a request does not depend on the number of policies or on the number of action patterns
+func newPolicySnapshot(policies []BasicPolicy) *policySnapshot {
+	snapshot := &policySnapshot{
+		policies:   policies,
+		users:      make(map[string][]int),
+		groups:     make(map[string][]int),
+		principals: make(map[string]map[string][]principalPattern),
+	}
+	actions := core.Actions()
+	for i := range policies {
+		policy := &policies[i]
+		for _, user := range policy.Users {
+			snapshot.users[user] = append(snapshot.users[user], i)
+		}
+		for _, group := range policy.Groups {
+			snapshot.groups[group] = append(snapshot.groups[group], i)
+		}
+		for field, patterns := range policy.Principals {
+			if snapshot.principals[field] == nil {
+				snapshot.principals[field] = make(map[string][]principalPattern)
+			}
+			for _, pattern := range patterns {
+				prefix := policy.prefix(pattern)
+				snapshot.principals[field][prefix] = append(snapshot.principals[field][prefix], principalPattern{policy: i, pattern: pattern})
+			}
+		}
+		policy.actions = indexActions(actions, policy.actionPatterns)
+		policy.denyActions = indexActions(actions, policy.denyActionPatterns)
+	}
+	return snapshot
+}
+
+// indexActions maps each action to the first pattern that matches it (nil if none)
+func indexActions(actions []string, patterns []*actionPattern) map[string]*actionPattern {
+	index := make(map[string]*actionPattern, len(actions))
+	for _, action := range actions {
+		index[action] = nil
+		for _, pattern := range patterns {
+			if pattern.re.MatchString(action) {
+				index[action] = pattern
+				break
+			}
+		}
+	}
+	return index
+}
+
+// userPolicies returns the indexes of the policies that apply to the principal or to the principal groups, in policy order
+func (s *policySnapshot) userPolicies(principal *core.Principal, groups []string) []int {
+	applies := make(map[int]bool)
+	for _, i := range s.users[principal.User] {
+		applies[i] = true
+	}
+	for _, group := range groups {
+		for _, i := range s.groups[group] {
+			applies[i] = true
+		}
+	}
+	// Only the patterns whose literal prefix is a prefix of the attribute value can match it
+	for field, values := range principal.Attributes {
+		prefixes := s.principals[field]
+		if prefixes == nil {
+			continue
+		}
+		for _, value := range values {
+			for end := 0; end <= len(value); end++ {
+				for _, candidate := range prefixes[value[:end]] {
+					if applies[candidate.policy] {
+						continue
+					}
+					if match, err := s.policies[candidate.policy].match(candidate.pattern, value); err == nil && match {
+						applies[candidate.policy] = true
+					}
+				}
+			}
+		}
+	}
+
+	indexes := make([]int, 0, len(applies))
+	for i := range applies {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// policyExtensions are the file extensions of the policy files loaded from a policy directory
+var policyExtensions = map[string]bool{".json": true, ".yaml": true, ".yml": true, ".toml": true}
+
+// loadPolicyPath loads the policies of a policy file, or of all the policy files in a policy directory, in file name order.
+// Any invalid file fails the whole set, so policies are never partially loaded.
+// A file is loaded once, even if it is also included by another file or included several times
+func loadPolicyPath(policyPath string) ([]BasicPolicy, error) {
+	info, err := os.Stat(policyPath)
+	if err != nil {
+		return nil, err
+	}
+	loaded := make(map[string]bool)
+	if !info.IsDir() {
+		return loadPolicyFile(policyPath, make(map[string]bool), loaded)
+	}
+
+	files, err := policyDirFiles(policyPath)
+	if err != nil {
+		return nil, err
+	}
+	var policies []BasicPolicy
+	for _, file := range files {
+		filePolicies, err := loadPolicyFile(file, make(map[string]bool), loaded)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, filePolicies...)
+	}
+	return policies, nil
+}
+
+// policyDirFiles returns the policy files in the directory, in file name order.
+// Hidden files (e.g., the ..data link of a Kubernetes ConfigMap volume) and files with other extensions are skipped
+func policyDirFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || !policyExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			continue
+		}
+		file := filepath.Join(dir, entry.Name())
+		// Policy files can be symbolic links (e.g., in a ConfigMap volume)
+		if info, err := os.Stat(file); err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// loadPolicyFile loads the policies of the files the policy file includes, followed by the policy file policies.
+// loading holds the files that are being loaded, to detect include cycles, and loaded holds the files that were already loaded, which are skipped
+func loadPolicyFile(file string, loading, loaded map[string]bool) ([]BasicPolicy, error) {
+	absPath, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	if loading[absPath] {
+		return nil, fmt.Errorf("policy file %q is included recursively", file)
+	}
+	if loaded[absPath] {
+		return nil, nil
+	}
+	loading[absPath] = true
+	loaded[absPath] = true
+	defer delete(loading, absPath)
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodePolicyDocument(file, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse policy file %q: %s", file, err.Error())
+	}
+
+	var policies []BasicPolicy
+	for _, include := range doc.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(file), include)
+		}
+		matches, err := filepath.Glob(include)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include %q in policy file %q: %s", include, file, err.Error())
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("include %q in policy file %q does not match any file", include, file)
+		}
+		for _, match := range matches {
+			included, err := loadPolicyFile(match, loading, loaded)
+			if err != nil {
+				return nil, err
+			}
+			policies = append(policies, included...)
+		}
+	}
+
+	for i, raw := range doc.Policies {
+		var policy BasicPolicy
+		if err := decodeStrict(raw, &policy); err != nil {
+			return nil, fmt.Errorf("invalid policy #%d in policy file %q: %s", i+1, file, err.Error())
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// decodePolicyDocument decodes the policy file according to its extension (JSON if the extension is unknown)
+func decodePolicyDocument(file string, data []byte) (*policyDocument, error) {
+	var value interface{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return decodeYAMLPolicyDocuments(data)
+	case ".toml":
+		var table map[string]interface{}
+		if _, err := toml.Decode(string(data), &table); err != nil {
+			return nil, err
+		}
+		value = table
+	default:
+		return decodeJSONPolicyDocument(data, true)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSONPolicyDocument(data, false)
+}
+
+// yamlDocumentStart matches the YAML document start markers, which separate the documents of a YAML stream
+var yamlDocumentStart = regexp.MustCompile(`(?m)^---(?:[ \t]+|\r?$)`)
+
+// decodeYAMLPolicyDocuments decodes each document of a YAML stream (documents are separated by ---) as a policy document,
+// and merges the documents includes and policies in document order
+func decodeYAMLPolicyDocuments(data []byte) (*policyDocument, error) {
+	var merged policyDocument
+	documents := yamlDocumentStart.Split(string(data), -1)
+	if len(documents) > 1 && strings.TrimSpace(documents[0]) == "" {
+		documents = documents[1:]
+	}
+	for i, document := range documents {
+		var value interface{}
+		if err := yaml.Unmarshal([]byte(document), &value); err != nil {
+			return nil, fmt.Errorf("document %d: %s", i+1, err.Error())
+		}
+		encoded, err := json.Marshal(yamlToJSON(value))
+		if err != nil {
+			return nil, err
+		}
+		doc, err := decodeJSONPolicyDocument(encoded, false)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %s", i+1, err.Error())
+		}
+		merged.Include = append(merged.Include, doc.Include...)
+		merged.Policies = append(merged.Policies, doc.Policies...)
+	}
+	return &merged, nil
+}
+
+// decodeJSONPolicyDocument decodes a JSON policy document or a JSON list of policies.
+// If lines is set, JSON objects that are not policy documents are decoded as a single policy, or one policy object per line
+func decodeJSONPolicyDocument(data []byte, lines bool) (*policyDocument, error) {
+	var doc policyDocument
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return &doc, nil
+	}
+	if trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &doc.Policies); err != nil {
+			return nil, err
+		}
+		return &doc, nil
+	}
+
+	if !lines || isPolicyDocument(trimmed) {
+		if err := decodeStrict(trimmed, &doc); err != nil {
+			return nil, err
+		}
+		return &doc, nil
+	}
+
+	// A single (possibly multiline) policy object
+	var policy json.RawMessage
+	if err := json.Unmarshal(trimmed, &policy); err == nil {
+		doc.Policies = append(doc.Policies, policy)
+		return &doc, nil
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var policy json.RawMessage
+		if err := json.Unmarshal([]byte(line), &policy); err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err.Error())
+		}
+		doc.Policies = append(doc.Policies, policy)
+	}
+	return &doc, nil
+}
+
+// decodeStrict decodes the JSON data, fields that are not part of the schema are rejected
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// isPolicyDocument checks whether the JSON data is a policy document, rather than a single policy object
+func isPolicyDocument(data []byte) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return false
+	}
+	_, hasPolicies := fields["policies"]
+	_, hasInclude := fields["include"]
+	return hasPolicies || hasInclude
+}
+
+// yamlToJSON converts a decoded YAML value to a value that can be encoded to JSON (YAML mappings keys are not necessarily strings)
+func yamlToJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = yamlToJSON(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = yamlToJSON(item)
+		}
+		return v
+	}
+	return value
+}
+
+// validatePolicies validates the loaded policies beyond their schema, e.g., policy names must be unique and patterns must compile.
+// The action patterns are compiled once, when the policies are loaded
+func validatePolicies(policies []BasicPolicy) error {
+	names := make(map[string]bool)
+	for i := range policies {
+		policy := &policies[i]
+		if policy.Name == "" {
+			return fmt.Errorf("invalid policy #%d: name is missing", i+1)
+		}
+		if names[policy.Name] {
+			return fmt.Errorf("invalid policy '%s': duplicate policy name", policy.Name)
+		}
+		names[policy.Name] = true
+
+		if err := validatePolicy(policy); err != nil {
+			return fmt.Errorf("invalid policy '%s': %s", policy.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+// validatePolicy validates a single policy
+func validatePolicy(policy *BasicPolicy) error {
+	// A policy without subjects never applies, and is most likely a mistake (e.g., a misspelled users field)
+	if len(policy.Users) == 0 && len(policy.Groups) == 0 && len(policy.Principals) == 0 {
+		return fmt.Errorf("users, groups or principals are missing")
+	}
+	if err := core.ValidateMode(policy.Mode); err != nil {
+		return err
+	}
+	if policy.Owner != "" && policy.Owner != OwnerUser && policy.Owner != OwnerGroup {
+		return fmt.Errorf("unsupported owner '%s'", policy.Owner)
+	}
+	// Resource kinds that are not restricted are not validated at all, so a misspelled kind (e.g., containers) would lift the restriction
+	if err := validateKeys("resource", policy.Resources, core.Resources()); err != nil {
+		return err
+	}
+	// Principal fields that are not extracted never match, and could be mistaken for a restriction
+	if err := validateKeys("principal field", policy.Principals, core.PrincipalFields); err != nil {
+		return err
+	}
+	for _, version := range []string{policy.MinAPIVersion, policy.DeprecatedAPIVersion} {
+		if version == "" {
+			continue
+		}
+		if err := core.ValidateAPIVersion(version); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if policy.actionPatterns, err = compileActionPatterns(policy.Name, policy.Actions); err != nil {
+		return err
+	}
+	if policy.denyActionPatterns, err = compileActionPatterns(policy.Name, policy.DenyActions); err != nil {
+		return err
+	}
+	if policy.patternSet, err = compilePatterns(policyPatterns(policy)); err != nil {
+		return err
+	}
+	// Sub policies share the compiled patterns of the policy
+	if policy.Container != nil {
+		policy.Container.patternSet = policy.patternSet
+	}
+	if policy.Exec != nil {
+		policy.Exec.patternSet = policy.patternSet
+	}
+	if policy.Image != nil {
+		policy.Image.patternSet = policy.patternSet
+	}
+	if policy.Volume != nil {
+		policy.Volume.patternSet = policy.patternSet
+	}
+	if policy.Network != nil {
+		policy.Network.patternSet = policy.patternSet
+	}
+	if policy.Build != nil {
+		policy.Build.patternSet = policy.patternSet
+	}
+	if policy.Network != nil {
+		for _, subnet := range policy.Network.Subnets {
+			if _, _, err := net.ParseCIDR(subnet); err != nil {
+				return fmt.Errorf("invalid subnet '%s'", subnet)
+			}
+		}
+	}
+	return nil
+}
+
+// validateKeys checks whether every key of the policy field is one of the supported keys
+func validateKeys(field string, values map[string][]string, supported []string) error {
+	known := make(map[string]bool, len(supported))
+	for _, key := range supported {
+		known[key] = true
+	}
+	var unsupported []string
+	for key := range values {
+		if !known[key] {
+			unsupported = append(unsupported, key)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return fmt.Errorf("unsupported %s '%s' (supported: %s)", field, strings.Join(unsupported, "', '"), strings.Join(supported, ", "))
+	}
+	return nil
+}
+
+// actionPattern is a compiled action (or deny action) pattern
+type actionPattern struct {
+	pattern string         // pattern is the pattern as specified in the policy
+	re      *regexp.Regexp // re is the compiled pattern
+}
+
+// compileActionPatterns compiles the action (or deny action) patterns of a policy.
+// Legacy patterns are compiled as before, with a warning that suggests the equivalent anchored pattern
+func compileActionPatterns(policy string, patterns []string) ([]*actionPattern, error) {
+	var compiled []*actionPattern
+	for _, pattern := range patterns {
+		// An empty pattern would be compiled as a legacy pattern that matches every action
+		if strings.TrimSpace(pattern) == "" {
+			return nil, fmt.Errorf("empty action pattern")
+		}
+		re, legacy, err := compileActionPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid action pattern '%s': %s", pattern, err.Error())
+		}
+		if legacy {
+			logrus.Warnf("Action pattern '%s' of policy '%s' is an unanchored regular expression, which is deprecated. Use '%s' instead",
+				pattern, policy, legacyActionReplacement(pattern, re))
+		}
+		compiled = append(compiled, &actionPattern{pattern: pattern, re: re})
+	}
+	return compiled, nil
+}
+
+// compileActionPattern compiles an action pattern, which is either an exact action (e.g., container_create), a glob (e.g., container_*)
+// or an anchored regular expression when prefixed with re: (e.g., re:container_(start|stop)).
+// Patterns that are not prefixed with re: and do not match any action as a glob are legacy patterns, which
+// are unanchored regular expressions (e.g., container matches any action that contains container)
+func compileActionPattern(pattern string) (re *regexp.Regexp, legacy bool, err error) {
+	if strings.HasPrefix(pattern, regexPatternPrefix) {
+		re, err = regexp.Compile("^(?:" + strings.TrimPrefix(pattern, regexPatternPrefix) + ")$")
+		return re, false, err
+	}
+
+	glob := regexp.MustCompile(globToRegexp(pattern))
+	for _, action := range core.Actions() {
+		if glob.MatchString(action) {
+			return glob, false, nil
+		}
+	}
+	re, err = regexp.Compile(pattern)
+	return re, true, err
+}
+
+// legacyActionReplacement returns an anchored action pattern that matches the same actions as the legacy pattern
+func legacyActionReplacement(pattern string, legacy *regexp.Regexp) string {
+	candidates := []string{regexPatternPrefix + pattern}
+	if regexp.QuoteMeta(pattern) == pattern {
+		candidates = append(candidates, pattern+"_*", pattern+"*", "*"+pattern+"*")
+	}
+	for _, candidate := range candidates {
+		if re, candidateLegacy, err := compileActionPattern(candidate); err == nil && !candidateLegacy && sameActions(re, legacy) {
+			return candidate
+		}
+	}
+	return regexPatternPrefix + ".*(?:" + pattern + ").*"
+}
+
+// sameActions checks whether both patterns match the same docker actions
+func sameActions(re, other *regexp.Regexp) bool {
+	for _, action := range core.Actions() {
+		if re.MatchString(action) != other.MatchString(action) {
+			return false
+		}
+	}
+	return true
+}
+
+// policyPatterns returns the glob and regular expression patterns of the policy and its restrictions
+func policyPatterns(policy *BasicPolicy) []string {
+	var patterns []string
+	for _, resourcePatterns := range policy.Resources {
+		patterns = append(patterns, resourcePatterns...)
+	}
+	for _, principalPatterns := range policy.Principals {
+		patterns = append(patterns, principalPatterns...)
+	}
+	if c := policy.Container; c != nil {
+		patterns = append(append(append(patterns, c.BindMounts...), c.Devices...), c.CgroupParents...)
+	}
+	if i := policy.Image; i != nil {
+		patterns = append(append(patterns, i.Registries...), i.Repositories...)
+	}
+	if v := policy.Volume; v != nil {
+		patterns = append(append(append(patterns, v.Drivers...), v.BindMounts...), v.MountTypes...)
+	}
+	if n := policy.Network; n != nil {
+		patterns = append(append(patterns, n.Drivers...), n.Options...)
+	}
+	if b := policy.Build; b != nil {
+		patterns = append(append(patterns, b.RemoteHosts...), b.DenyBuildArgs...)
+	}
+	if e := policy.Exec; e != nil {
+		for _, command := range append(append([]string{}, e.Commands...), e.DenyCommands...) {
+			patterns = append(patterns, strings.Fields(command)...)
+		}
+	}
+	return patterns
+}
@@ -0,0 +1,372 @@
+package authz
+
+import (
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+	"github.com/twistlock/authz/core"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writePolicyDir recreates the policy directory with the given files
+func writePolicyDir(t *testing.T, dir string, files map[string]string) {
+	assert.NoError(t, os.RemoveAll(dir))
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+// policyNames returns the names of the policies, in order
+func policyNames(policies []BasicPolicy) []string {
+	var names []string
+	for _, policy := range policies {
+		names = append(names, policy.Name)
+	}
+	return names
+}
+
+func TestLoadPolicyFormats(t *testing.T) {
+
+	const dir = "/tmp/policy_formats"
+	writePolicyDir(t, dir, map[string]string{
+		"lines.json":    "{\"name\":\"line_1\",\"users\":[\"alice\"],\"actions\":[\"container\"]}\n\n  {\"name\":\"line_2\",\"users\":[\"bob\"]}\n",
+		"document.json": `{"policies":[{"name":"json_1","users":["alice"],"min_api_version":"1.40"}]}`,
+		"list.json":     `[{"name":"list_1"},{"name":"list_2"}]`,
+		"single.json":   "{\n  \"name\": \"single\",\n  \"users\": [\"alice\"]\n}\n",
+		"policy.yaml":   "policies:\n  - name: yaml_1\n    users: [alice]\n    actions: [container_list]\n    resources:\n      container: [\"alice-*\"]\n    min_api_version: \"1.40\"\n",
+		"list.yml":      "- name: yml_1\n  readonly: true\n",
+		"policy.toml":   "[[policies]]\nname = \"toml_1\"\nusers = [\"alice\"]\nactions = [\"image\"]\n\n[policies.image]\nregistries = [\"registry.local\"]\n",
+		"empty.yaml":    "",
+		"stream.yaml":   "---\n- name: stream_1\n---\n# Comment only document\n--- \npolicies:\n  - name: stream_2\n...\n--- [{name: stream_3}]\n",
+	})
+
+	tests := []struct {
+		file          string
+		expectedNames []string
+	}{
+		{"lines.json", []string{"line_1", "line_2"}},
+		{"document.json", []string{"json_1"}},
+		{"list.json", []string{"list_1", "list_2"}},
+		{"single.json", []string{"single"}},
+		{"policy.yaml", []string{"yaml_1"}},
+		{"list.yml", []string{"yml_1"}},
+		{"policy.toml", []string{"toml_1"}},
+		{"empty.yaml", nil},
+		{"stream.yaml", []string{"stream_1", "stream_2", "stream_3"}},
+	}
+
+	for _, test := range tests {
+		policies, err := loadPolicyPath(filepath.Join(dir, test.file))
+		if assert.NoError(t, err, test.file) {
+			assert.Equal(t, test.expectedNames, policyNames(policies), test.file)
+		}
+	}
+
+	// Policies have the same schema regardless of the file format
+	policies, err := loadPolicyPath(filepath.Join(dir, "policy.yaml"))
+	if assert.NoError(t, err) && assert.Len(t, policies, 1) {
+		assert.Equal(t, []string{"alice"}, policies[0].Users)
+		assert.Equal(t, map[string][]string{"container": {"alice-*"}}, policies[0].Resources)
+		assert.Equal(t, "1.40", policies[0].MinAPIVersion)
+	}
+	policies, err = loadPolicyPath(filepath.Join(dir, "policy.toml"))
+	if assert.NoError(t, err) && assert.Len(t, policies, 1) && assert.NotNil(t, policies[0].Image) {
+		assert.Equal(t, []string{"registry.local"}, policies[0].Image.Registries)
+	}
+}
+
+func TestLoadPolicyDirectory(t *testing.T) {
+
+	const dir = "/tmp/policy_dir"
+	writePolicyDir(t, dir, map[string]string{
+		"20-team.yaml":         "include: [\"teams/*.yaml\"]\npolicies:\n  - name: team\n",
+		"10-base.toml":         "[[policies]]\nname = \"base\"\n",
+		"30-legacy.json":       `{"name":"legacy"}`,
+		"README.md":            "Not a policy file",
+		".hidden.json":         `{"name":"hidden"}`,
+		"teams/b.yaml":         "- name: team_b\n",
+		"teams/a.yaml":         "include: [\"../common/shared.json\"]\npolicies:\n  - name: team_a\n",
+		"common/shared.json":   `{"policies":[{"name":"shared"}]}`,
+		"subdir.json/ignored":  "",
+		"40-empty.toml":        "",
+		"50-absolute.yaml":     "include: [\"/tmp/policy_dir/common/shared.json\"]\n",
+		"60-included.yaml":     "- name: included\n",
+		"05-include-dir.yaml":  "include: [\"60-included.yaml\", \"./60-included.yaml\"]\n",
+		"teams/not-policy.txt": "",
+	})
+
+	policies, err := loadPolicyPath(dir)
+	if assert.NoError(t, err) {
+		// Files are loaded in file name order, included files are loaded before the including file policies.
+		// Each file is loaded once, even if it is included several times or also loaded from the directory
+		assert.Equal(t, []string{"included", "base", "shared", "team_a", "team_b", "team", "legacy"}, policyNames(policies))
+	}
+
+	invalid := []struct {
+		files map[string]string
+		desc  string
+	}{
+		{map[string]string{"a.json": `{"name":"a"}`, "b.json": "{\"name\":\"b\"}\n{\"name\":"}, "malformed JSON line"},
+		{map[string]string{"a.json": `{"name":"a"}`, "b.yaml": "policies:\n  - name: [b\n"}, "malformed YAML"},
+		{map[string]string{"a.yaml": "- name: a\n---\npolicies:\n  - name: [b\n"}, "malformed YAML document"},
+		{map[string]string{"a.json": `{"name":"a"}`, "b.toml": "[[policies]\nname = \"b\"\n"}, "malformed TOML"},
+		{map[string]string{"a.yaml": "- name: a\n  users: alice\n"}, "invalid policy schema"},
+		{map[string]string{"a.yaml": "include: [missing.yaml]\n"}, "missing include"},
+		{map[string]string{"a.yaml": "include: [b.yaml]\n", "b.yaml": "include: [a.yaml]\n"}, "include cycle"},
+		{map[string]string{"a.yaml": "include: [a.yaml]\n"}, "self include"},
+	}
+	for _, test := range invalid {
+		writePolicyDir(t, dir, test.files)
+		_, err := loadPolicyPath(dir)
+		assert.Error(t, err, test.desc)
+	}
+}
+
+func TestReloadInvalidPolicies(t *testing.T) {
+
+	const dir = "/tmp/policy_reload"
+	writePolicyDir(t, dir, map[string]string{
+		"10-alice.yaml": "- name: alice\n  users: [alice]\n  actions: [container_list]\n",
+		"20-bob.yaml":   "- name: bob\n  users: [bob]\n  actions: [container_list]\n",
+	})
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: dir})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	allowed := func(user string) bool {
+		return authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodGet, RequestURI: "/v1.40/containers/json", User: user}).Allow
+	}
+	assert.True(t, allowed("alice"))
+	assert.True(t, allowed("bob"))
+
+	// An invalid file rejects the whole set, the previous policies remain in effect
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "20-bob.yaml"), []byte("- name: [bob\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "10-alice.yaml"), []byte("- name: alice\n  users: [carol]\n  actions: [container_list]\n"), 0644))
+	assert.Error(t, authorizer.(*basicAuthorizer).loadPolicies())
+	assert.True(t, allowed("alice"))
+	assert.True(t, allowed("bob"))
+	assert.False(t, allowed("carol"))
+}
+
+func TestValidatePolicies(t *testing.T) {
+
+	tests := []struct {
+		policies       string
+		expectedReason string // expectedReason is the expected validation error prefix, empty if the policies are valid
+	}{
+		{`{"name":"ops","users":["alice"],"actions":["container"]}`, ""},
+		{`{"name":"ops","groups":["ops"],"actions":["container"]}`, ""},
+		{`{"name":"ops","principals":{"ou":["ops-*"]},"actions":["container"]}`, ""},
+		{`{"name":"anonymous","users":[""],"actions":["docker_version"]}`, ""},
+		{`{"users":["alice"],"actions":["container"]}`, "invalid policy #1: name is missing"},
+		{`{"name":"ops","actions":["*"]}`, "invalid policy 'ops': users, groups or principals are missing"},
+		{`{"name":"ops","users":[],"groups":[],"actions":["*"]}`, "invalid policy 'ops': users, groups or principals are missing"},
+		{"{\"name\":\"ops\",\"users\":[\"alice\"]}\n{\"name\":\"ops\",\"users\":[\"bob\"]}", "invalid policy 'ops': duplicate policy name"},
+		{`{"name":"ops","users":["alice"],"actions":["container_(create"]}`, "invalid policy 'ops': invalid action pattern 'container_(create': error parsing regexp"},
+		{`{"name":"ops","users":["alice"],"deny_actions":["swarm["]}`, "invalid policy 'ops': invalid action pattern 'swarm[': error parsing regexp"},
+		{`{"name":"ops","users":["alice"],"resources":{"container":["re:alice-(["]}}`, "invalid policy 'ops': invalid pattern 're:alice-([': error parsing regexp"},
+		{`{"name":"ops","principals":{"uri":["re:spiffe://(x"]}}`, "invalid policy 'ops': invalid pattern 're:spiffe://(x': error parsing regexp"},
+		{`{"name":"ops","users":["alice"],"exec":{"commands":["cat re:/var/log/(x"]}}`, "invalid policy 'ops': invalid pattern 're:/var/log/(x': error parsing regexp"},
+		{`{"name":"ops","users":["alice"],"network":{"subnets":["10.0.0.0"]}}`, "invalid policy 'ops': invalid subnet '10.0.0.0'"},
+		{`{"name":"ops","users":["alice"],"mode":"audit"}`, "invalid policy 'ops': unsupported mode 'audit'"},
+		{`{"name":"ops","users":["alice"],"owner":"team"}`, "invalid policy 'ops': unsupported owner 'team'"},
+		{`{"name":"ops","principals":{"uri":["spiffe://corp/*"],"URI":["spiffe://corp/*"]}}`, "invalid policy 'ops': unsupported principal field 'URI'"},
+		{`{"name":"ops","principals":{"common_name":["alice"]}}`, "invalid policy 'ops': unsupported principal field 'common_name'"},
+		{`{"name":"ops","users":["alice"],"actions":["container_list",""]}`, "invalid policy 'ops': empty action pattern"},
+		{`{"name":"ops","users":["alice"],"actions":["*"],"deny_actions":[" "]}`, "invalid policy 'ops': empty action pattern"},
+		{`{"name":"ops","users":["alice"],"resources":{"containers":["alice-*"],"image":["alpine"]}}`, "invalid policy 'ops': unsupported resource 'containers'"},
+		{`{"name":"ops","users":["alice"],"resources":{"container":["alice-*"],"swarm":[],"Volume":["x"]}}`, "invalid policy 'ops': unsupported resource 'Volume'"},
+	}
+
+	const policyFileName = "/tmp/policy_validate.json"
+	for _, test := range tests {
+		assert.NoError(t, ioutil.WriteFile(policyFileName, []byte(test.policies), 0644))
+		policies, err := loadPolicyPath(policyFileName)
+		if !assert.NoError(t, err, test.policies) {
+			continue
+		}
+		err = validatePolicies(policies)
+		if test.expectedReason == "" {
+			assert.NoError(t, err, test.policies)
+		} else if assert.Error(t, err, test.policies) {
+			assert.True(t, strings.HasPrefix(err.Error(), test.expectedReason), "Unexpected error %q for %s", err.Error(), test.policies)
+		}
+	}
+
+	// Fields that are not part of the schema are rejected, in policies and in policy documents
+	unknownFields := map[string]string{
+		"/tmp/policy_unknown.json": `{"name":"ops","user":["alice"],"actions":["container"]}`,
+		"/tmp/policy_unknown.yaml": "- name: ops\n  users: [alice]\n  container:\n    allow_privileged: true\n    bind_mount: [\"/\"]\n",
+		"/tmp/policy_unknown.toml": "[[policy]]\nname = \"ops\"\nusers = [\"alice\"]\n",
+	}
+	for file, content := range unknownFields {
+		assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+		_, err := loadPolicyPath(file)
+		if assert.Error(t, err, file) {
+			assert.Contains(t, err.Error(), "unknown field", file)
+		}
+	}
+}
+
+// testEventAuditor records the audited events
+type testEventAuditor struct {
+	events []map[string]interface{}
+}
+
+func (a *testEventAuditor) AuditEvent(event string, fields map[string]interface{}) error {
+	fields["event"] = event
+	a.events = append(a.events, fields)
+	return nil
+}
+
+func TestPolicyLoadFailureAudit(t *testing.T) {
+
+	const policyFileName = "/tmp/policy_audit.json"
+	assert.NoError(t, ioutil.WriteFile(policyFileName, []byte(`{"name":"ops","users":["alice"],"actions":["container_list"]}`), 0644))
+
+	auditor := &testEventAuditor{}
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyFileName, EventAuditor: auditor})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+	assert.Empty(t, auditor.events)
+
+	// A zero-valued policy must not replace the valid policies
+	assert.NoError(t, ioutil.WriteFile(policyFileName, []byte("{\"name\":\"ops\",\"users\":[\"bob\"],\"actions\":[\"container_list\"]}\n{\"actions\":[\"\"]}"), 0644))
+	assert.Error(t, authorizer.(*basicAuthorizer).loadPolicies())
+
+	res := authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodGet, RequestURI: "/v1.40/containers/json", User: "alice"})
+	assert.True(t, res.Allow, "Previous valid policies must remain in effect")
+	res = authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodGet, RequestURI: "/v1.40/containers/json", User: "bob"})
+	assert.False(t, res.Allow, "Invalid policies must not be loaded")
+
+	if assert.NotEmpty(t, auditor.events) {
+		event := auditor.events[len(auditor.events)-1]
+		assert.Equal(t, "Policy load failed", event["event"])
+		assert.Equal(t, policyFileName, event["policy_path"])
+		assert.Equal(t, "invalid policy #2: name is missing", event["err"])
+		assert.Equal(t, 1, event["active_policies"])
+	}
+}
+
+func TestPolicyIndex(t *testing.T) {
+
+	policies := []BasicPolicy{
+		{Name: "alice", Users: []string{"alice"}, Actions: []string{"container_list"}},
+		{Name: "ops", Groups: []string{"ops"}, Actions: []string{"container_*"}, DenyActions: []string{"re:container_(kill|delete)"}},
+		{Name: "spiffe", Principals: map[string][]string{"uri": {"spiffe://corp/*"}}, Actions: []string{"*"}},
+		{Name: "alice-ops", Users: []string{"alice", "alice"}, Groups: []string{"ops"}, Actions: []string{"image_*"}},
+		{Name: "bob", Users: []string{"bob"}, Actions: []string{"container_list"}},
+		{Name: "ci", Principals: map[string][]string{"cn": {"ci"}, "ou": {"build-?"}}, Actions: []string{"image_*"}},
+		{Name: "sre", Principals: map[string][]string{"email": {"re:[a-z]+@(sre|ops)\\.acme\\.io"}}, Actions: []string{"container_*"}},
+	}
+	assert.NoError(t, validatePolicies(policies))
+	snapshot := newPolicySnapshot(policies)
+
+	tests := []struct {
+		principal       core.Principal
+		groups          []string
+		expectedIndexes []int
+	}{
+		{core.Principal{User: "alice"}, nil, []int{0, 3}},
+		{core.Principal{User: "alice"}, []string{"ops"}, []int{0, 1, 3}},
+		{core.Principal{User: "carol"}, []string{"ops", "dev"}, []int{1, 3}},
+		{core.Principal{User: "carol", Attributes: map[string][]string{"uri": {"spiffe://corp/ci"}}}, nil, []int{2}},
+		{core.Principal{User: "carol"}, nil, []int{}},
+		{core.Principal{User: "carol", Attributes: map[string][]string{"cn": {"ci"}}}, nil, []int{5}},
+		{core.Principal{User: "carol", Attributes: map[string][]string{"cn": {"ci-runner"}, "ou": {"build-1", "dev"}}}, nil, []int{5}},
+		{core.Principal{User: "carol", Attributes: map[string][]string{"ou": {"build-10"}, "uri": {"spiffe://other/ci"}}}, nil, []int{}},
+		{core.Principal{User: "bob", Attributes: map[string][]string{"email": {"bob@sre.acme.io"}, "uri": {"spiffe://corp/bob"}}}, nil, []int{2, 4, 6}},
+		{core.Principal{User: "carol", Attributes: map[string][]string{"email": {"carol@sre.acme.io.evil"}, "cn": {"ci"}}}, nil, []int{5}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expectedIndexes, snapshot.userPolicies(&test.principal, test.groups), "%v %v", test.principal, test.groups)
+	}
+
+	// Indexed actions match as their patterns, actions that are not indexed never match
+	ops := &snapshot.policies[1]
+	for _, action := range core.Actions() {
+		var expectedPattern string
+		for _, pattern := range ops.actionPatterns {
+			if pattern.re.MatchString(action) {
+				expectedPattern = pattern.pattern
+				break
+			}
+		}
+		pattern, match := matchAction(ops.actions, action)
+		assert.Equal(t, expectedPattern != "", match, action)
+		assert.Equal(t, expectedPattern, pattern, action)
+	}
+	pattern, match := matchAction(ops.denyActions, core.ActionContainerKill)
+	assert.True(t, match)
+	assert.Equal(t, "re:container_(kill|delete)", pattern)
+	for _, action := range []string{core.ActionNone, "unknown"} {
+		_, match = matchAction(snapshot.policies[2].actions, action)
+		assert.False(t, match, "Action '%s' that is not mapped must not match the * pattern", action)
+	}
+}
+
+func TestActionPatterns(t *testing.T) {
+
+	tests := []struct {
+		pattern        string
+		action         string
+		expectedMatch  bool
+		expectedLegacy bool
+	}{
+		{"container_create", core.ActionContainerCreate, true, false},
+		{"container_create", core.ActionContainerExecCreate, false, false},
+		{"container_*", core.ActionContainerExecCreate, true, false},
+		{"container_*", core.ActionImageCreate, false, false},
+		{"*_create", core.ActionVolumeCreate, true, false},
+		{"*", core.ActionSwarmLeave, true, false},
+		{"re:container_(start|stop)", core.ActionContainerStop, true, false},
+		{"re:container_(start|stop)", core.ActionContainerExecStart, false, false},
+		{"re:create", core.ActionContainerCreate, false, false},
+		// Legacy patterns are unanchored regular expressions
+		{"container", core.ActionContainerCreate, true, true},
+		{"create", core.ActionVolumeCreate, true, true},
+		{"", core.ActionSwarmLeave, true, true},
+		{".*", core.ActionSwarmLeave, true, true},
+		{"container_(start|stop)", core.ActionContainerStop, true, true},
+		{"exec_(start|create)", core.ActionContainerExecStart, true, true},
+	}
+
+	for _, test := range tests {
+		re, legacy, err := compileActionPattern(test.pattern)
+		if !assert.NoError(t, err, test.pattern) {
+			continue
+		}
+		assert.Equal(t, test.expectedMatch, re.MatchString(test.action), "%s %s", test.pattern, test.action)
+		assert.Equal(t, test.expectedLegacy, legacy, test.pattern)
+	}
+}
+
+func TestLegacyActionReplacement(t *testing.T) {
+
+	tests := []struct {
+		pattern             string
+		expectedReplacement string
+	}{
+		{"container", "container_*"},
+		{"create", "*create*"},
+		{"", "*"},
+		{".*", "re:.*"},
+		{"container_(start|stop)", "re:container_(start|stop)"},
+		{"exec_(start|create)", "re:.*(?:exec_(start|create)).*"},
+		{"^container_(start|stop)$", "re:^container_(start|stop)$"},
+	}
+
+	for _, test := range tests {
+		re, legacy, err := compileActionPattern(test.pattern)
+		if !assert.NoError(t, err, test.pattern) || !assert.True(t, legacy, test.pattern) {
+			continue
+		}
+		assert.Equal(t, test.expectedReplacement, legacyActionReplacement(test.pattern, re), test.pattern)
+	}
+}
@@ -0,0 +1,230 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/twistlock/authz/core"
+	"net/http"
+	"strings"
+)
+
+// listedObject is a single object revealed by a list response
+type listedObject struct {
+	ids    []string          // ids are the object names and id the object can be referred by, names first
+	labels map[string]string // labels are the object labels
+}
+
+// isListAction checks whether the action lists objects that can be restricted in the response phase
+func isListAction(action string) bool {
+	switch action {
+	case core.ActionContainerList, core.ActionImageList, core.ActionVolumeList, core.ActionNetworkList:
+		return true
+	}
+	return false
+}
+
+// validateListResponse validates every object revealed by the list response is in the scope of at least one of the policies
+func validateListResponse(policies []*BasicPolicy, authZReq *authorization.Request, route *core.RouteInfo) error {
+	for _, policy := range policies {
+		if !policyRestrictsList(policy, route.Resource) {
+			// Policy scope is unrestricted, all objects can be revealed
+			return nil
+		}
+	}
+	if authZReq.ResponseStatusCode != 0 && authZReq.ResponseStatusCode != http.StatusOK {
+		return nil
+	}
+
+	// The body is not passed to the plugin if it is too large (or not JSON), in which case the scope cannot be validated
+	if len(authZReq.ResponseBody) == 0 {
+		return fmt.Errorf("response body is missing")
+	}
+
+	objects, err := decodeListResponse(route.Action, authZReq.ResponseBody)
+	if err != nil {
+		return err
+	}
+
+	var outOfScope []string
+	for _, object := range objects {
+		inScope := false
+		for _, policy := range policies {
+			if objectInScope(policy, route.Resource, authZReq.User, object) {
+				inScope = true
+				break
+			}
+		}
+		if !inScope {
+			outOfScope = append(outOfScope, object.ids[0])
+		}
+	}
+
+	if len(outOfScope) > 0 {
+		return fmt.Errorf("%s '%s' not allowed", route.Resource, strings.Join(outOfScope, "', '"))
+	}
+	return nil
+}
+
+// validateInspectResponse validates the container_inspect response does not reveal environment variables that match the secret patterns,
+// unless any of the policies allows revealing secrets. Secrets revealed by a policy are described, so the decision is audited
+func validateInspectResponse(policies []*BasicPolicy, secretPatterns patternSet, authZReq *authorization.Request) (string, error) {
+	var revealer string
+	for _, policy := range policies {
+		if policy.RevealSecrets {
+			revealer = policy.Name
+			break
+		}
+	}
+	if authZReq.ResponseStatusCode != 0 && authZReq.ResponseStatusCode != http.StatusOK {
+		return "", nil
+	}
+
+	secrets, err := inspectSecrets(secretPatterns, authZReq.ResponseBody)
+	if err != nil {
+		if revealer != "" {
+			return fmt.Sprintf("secrets are allowed by policy '%s'", revealer), nil
+		}
+		return "", err
+	}
+	if len(secrets) == 0 {
+		return "", nil
+	}
+	if revealer != "" {
+		return fmt.Sprintf("secret environment variables '%s' revealed by policy '%s'", strings.Join(secrets, "', '"), revealer), nil
+	}
+	return "", fmt.Errorf("secret environment variables '%s' cannot be revealed", strings.Join(secrets, "', '"))
+}
+
+// inspectSecrets returns the names of the environment variables in the container_inspect response that match the secret patterns
+func inspectSecrets(secretPatterns patternSet, body []byte) ([]string, error) {
+	if len(body) == 0 {
+		return nil, fmt.Errorf("response body is missing")
+	}
+
+	var container struct {
+		Config *struct {
+			Env []string `json:"Env"`
+		} `json:"Config"`
+	}
+	if err := json.Unmarshal(body, &container); err != nil {
+		return nil, fmt.Errorf("invalid %s response: %s", core.ActionContainerInspect, err.Error())
+	}
+	if container.Config == nil {
+		return nil, nil
+	}
+
+	var secrets []string
+	for _, env := range container.Config.Env {
+		for _, re := range secretPatterns {
+			if re.MatchString(env) {
+				// Only the variable name is reported, the value is the secret
+				secrets = append(secrets, strings.SplitN(env, "=", 2)[0])
+				break
+			}
+		}
+	}
+	return secrets, nil
+}
+
+// policyRestrictsList checks whether the policy restricts the objects of the given resource kind that can be listed
+func policyRestrictsList(policy *BasicPolicy, resource string) bool {
+	_, ok := policy.Resources[resource]
+	return ok || ownerLabelRestricts(policy, resource)
+}
+
+// ownerLabelRestricts checks whether the policy owner label restricts the objects of the given resource kind.
+// The owner label is only required on created containers, so other objects (e.g., pulled images) are not restricted by it
+func ownerLabelRestricts(policy *BasicPolicy, resource string) bool {
+	return policy.OwnerLabel != "" && resource == core.ResourceContainer
+}
+
+// objectInScope checks whether the listed object matches the policy resource patterns and owner label
+func objectInScope(policy *BasicPolicy, resource, user string, object listedObject) bool {
+	if ownerLabelRestricts(policy, resource) && object.labels[policy.OwnerLabel] != user {
+		return false
+	}
+
+	patterns, ok := policy.Resources[resource]
+	if !ok {
+		return true
+	}
+	for _, id := range object.ids {
+		if matchResource(policy, resource, patterns, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeListResponse decodes the objects revealed by the list response of the given action
+func decodeListResponse(action string, body []byte) ([]listedObject, error) {
+	var objects []listedObject
+	var err error
+	switch action {
+	case core.ActionContainerList:
+		var containers []struct {
+			ID     string            `json:"Id"`
+			Names  []string          `json:"Names"`
+			Labels map[string]string `json:"Labels"`
+		}
+		if err = json.Unmarshal(body, &containers); err == nil {
+			for _, container := range containers {
+				var ids []string
+				for _, name := range container.Names {
+					ids = append(ids, strings.TrimPrefix(name, "/"))
+				}
+				ids = append(ids, container.ID)
+				objects = append(objects, listedObject{ids: ids, labels: container.Labels})
+			}
+		}
+	case core.ActionImageList:
+		var images []struct {
+			ID          string            `json:"Id"`
+			RepoTags    []string          `json:"RepoTags"`
+			RepoDigests []string          `json:"RepoDigests"`
+			Labels      map[string]string `json:"Labels"`
+		}
+		if err = json.Unmarshal(body, &images); err == nil {
+			for _, image := range images {
+				var ids []string
+				for _, ref := range append(image.RepoTags, image.RepoDigests...) {
+					// Untagged images are listed with <none> references
+					if !strings.HasPrefix(ref, "<none>") {
+						ids = append(ids, ref)
+					}
+				}
+				ids = append(ids, image.ID)
+				objects = append(objects, listedObject{ids: ids, labels: image.Labels})
+			}
+		}
+	case core.ActionVolumeList:
+		var volumes struct {
+			Volumes []struct {
+				Name   string            `json:"Name"`
+				Labels map[string]string `json:"Labels"`
+			} `json:"Volumes"`
+		}
+		if err = json.Unmarshal(body, &volumes); err == nil {
+			for _, volume := range volumes.Volumes {
+				objects = append(objects, listedObject{ids: []string{volume.Name}, labels: volume.Labels})
+			}
+		}
+	case core.ActionNetworkList:
+		var networks []struct {
+			ID     string            `json:"Id"`
+			Name   string            `json:"Name"`
+			Labels map[string]string `json:"Labels"`
+		}
+		if err = json.Unmarshal(body, &networks); err == nil {
+			for _, network := range networks {
+				objects = append(objects, listedObject{ids: []string{network.Name, network.ID}, labels: network.Labels})
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s response: %s", action, err.Error())
+	}
+	return objects, nil
+}
@@ -0,0 +1,146 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/swarm"
+	"strings"
+)
+
+// defaultCapabilities are the kernel capabilities docker grants containers by default
+var defaultCapabilities = []string{
+	"CHOWN", "DAC_OVERRIDE", "FSETID", "FOWNER", "MKNOD", "NET_RAW", "SETGID",
+	"SETUID", "SETFCAP", "SETPCAP", "NET_BIND_SERVICE", "SYS_CHROOT", "KILL", "AUDIT_WRITE",
+}
+
+// serviceSpec is the service create and update request body.
+// Only the task settings restricted by policies are decoded, including settings of API versions newer than the vendored
+// swarm types (e.g., CapabilityAdd), since daemons that support them apply them regardless of the vendored types
+type serviceSpec struct {
+	TaskTemplate struct {
+		ContainerSpec *serviceContainerSpec           `json:"ContainerSpec"`
+		PluginSpec    json.RawMessage                 `json:"PluginSpec"`
+		Runtime       swarm.RuntimeType               `json:"Runtime"`
+		Networks      []swarm.NetworkAttachmentConfig `json:"Networks"`
+	} `json:"TaskTemplate"`
+	Networks []swarm.NetworkAttachmentConfig `json:"Networks"` // Deprecated networks attachments in the top level of the spec
+}
+
+// serviceContainerSpec is the container spec of the service tasks
+type serviceContainerSpec struct {
+	Image      string        `json:"Image"`
+	Mounts     []mount.Mount `json:"Mounts"`
+	Privileges *struct {
+		SELinuxContext *struct {
+			Disable bool `json:"Disable"`
+		} `json:"SELinuxContext"`
+		Seccomp *struct {
+			Mode string `json:"Mode"`
+		} `json:"Seccomp"`
+		AppArmor *struct {
+			Mode string `json:"Mode"`
+		} `json:"AppArmor"`
+	} `json:"Privileges"`
+	CapabilityAdd []string `json:"CapabilityAdd"` // CapabilityAdd are the capabilities added to the default capabilities (API 1.41)
+	Capabilities  []string `json:"Capabilities"`  // Capabilities are the complete capabilities set, replacing the default capabilities (API 1.40)
+}
+
+// decodeServiceSpec decodes the service create or update request body
+func decodeServiceSpec(body []byte) (*serviceSpec, error) {
+	if len(body) == 0 {
+		return nil, fmt.Errorf("service specification is missing in request body")
+	}
+
+	var spec serviceSpec
+	if err := json.Unmarshal(body, &spec); err != nil {
+		return nil, fmt.Errorf("invalid service specification: %s", err.Error())
+	}
+	return &spec, nil
+}
+
+// validateServiceSpec validates the service task template against the container policy, the same as container_create
+func validateServiceSpec(policy *ContainerPolicy, body []byte) error {
+	spec, err := decodeServiceSpec(body)
+	if err != nil {
+		return err
+	}
+
+	// Plugin tasks install plugins on all the nodes, with the privileges the plugin requests
+	if spec.TaskTemplate.Runtime == swarm.RuntimePlugin || (len(spec.TaskTemplate.PluginSpec) > 0 && string(spec.TaskTemplate.PluginSpec) != "null") {
+		return fmt.Errorf("plugin services are not allowed")
+	}
+
+	for _, network := range append(spec.TaskTemplate.Networks, spec.Networks...) {
+		if network.Target == "host" && !policy.AllowHostNetwork {
+			return fmt.Errorf("host network mode is not allowed")
+		}
+	}
+
+	containerSpec := spec.TaskTemplate.ContainerSpec
+	if containerSpec == nil {
+		return nil
+	}
+
+	if err := validateCapabilities(policy, containerSpec.CapabilityAdd); err != nil {
+		return err
+	}
+	if err := validateCapabilitySet(policy, containerSpec.Capabilities); err != nil {
+		return err
+	}
+
+	for _, m := range containerSpec.Mounts {
+		if m.Type == mount.TypeBind {
+			if err := validateBindMount(policy, m.Source); err != nil {
+				return err
+			}
+		}
+	}
+
+	if privileges := containerSpec.Privileges; privileges != nil && !policy.AllowUnconfined {
+		if privileges.SELinuxContext != nil && privileges.SELinuxContext.Disable {
+			return fmt.Errorf("disabling SELinux labeling is not allowed")
+		}
+		if privileges.Seccomp != nil && strings.EqualFold(privileges.Seccomp.Mode, "unconfined") {
+			return fmt.Errorf("unconfined seccomp mode is not allowed")
+		}
+		if privileges.Seccomp != nil && strings.EqualFold(privileges.Seccomp.Mode, "custom") {
+			return fmt.Errorf("custom seccomp profiles are not allowed")
+		}
+		if privileges.AppArmor != nil && strings.EqualFold(privileges.AppArmor.Mode, "disabled") {
+			return fmt.Errorf("disabled apparmor mode is not allowed")
+		}
+	}
+	return nil
+}
+
+// validateServiceVolumes validates the volumes created by the service task mounts against the volume policy
+func validateServiceVolumes(policy *VolumePolicy, body []byte) error {
+	spec, err := decodeServiceSpec(body)
+	if err != nil {
+		return err
+	}
+	if spec.TaskTemplate.ContainerSpec == nil {
+		return nil
+	}
+
+	for _, m := range spec.TaskTemplate.ContainerSpec.Mounts {
+		if m.Type != mount.TypeVolume || m.VolumeOptions == nil || m.VolumeOptions.DriverConfig == nil {
+			continue
+		}
+		if err := validateVolume(policy, m.VolumeOptions.DriverConfig.Name, m.VolumeOptions.DriverConfig.Options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isDefaultCapability checks whether the capability is granted to containers by default
+func isDefaultCapability(capability string) bool {
+	for _, defaultCapability := range defaultCapabilities {
+		if normalizeCapability(capability) == defaultCapability {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package authz
+
+import (
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestValidateServiceSpec(t *testing.T) {
+
+	policy := &ContainerPolicy{
+		Capabilities: []string{"NET_ADMIN"},
+		BindMounts:   []string{"/srv/*"},
+	}
+
+	tests := []struct {
+		body           string
+		expectedReason string // expectedReason is the expected denial reason, empty if the request is allowed
+	}{
+		{`{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"nginx"}}}`, ""},
+		{`{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"nginx","Mounts":[{"Type":"bind","Source":"/srv/web","Target":"/web"}]}}}`, ""},
+		{`{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"nginx","Mounts":[{"Type":"bind","Source":"/var/run/docker.sock","Target":"/s"}]}}}`, "bind mount of '/var/run/docker.sock' is not allowed"},
+		{`{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"nginx","CapabilityAdd":["CAP_NET_ADMIN"]}}}`, ""},
+		{`{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"nginx","CapabilityAdd":["SYS_ADMIN"]}}}`, "capability 'SYS_ADMIN' is not allowed"},
+		{`{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"nginx","Capabilities":["CAP_CHOWN","CAP_KILL"]}}}`, ""},
+		{`{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"nginx","Capabilities":["CAP_CHOWN","CAP_SYS_ADMIN"]}}}`, "capability 'CAP_SYS_ADMIN' is not allowed"},
+		{`{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"nginx","Privileges":{"SELinuxContext":{"Disable":true}}}}}`, "disabling SELinux labeling is not allowed"},
+		{`{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"nginx","Privileges":{"Seccomp":{"Mode":"unconfined"}}}}}`, "unconfined seccomp mode is not allowed"},
+		{`{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"nginx","Privileges":{"Seccomp":{"Mode":"custom","Profile":"e30="}}}}}`, "custom seccomp profiles are not allowed"},
+		{`{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"nginx","Privileges":{"AppArmor":{"Mode":"disabled"}}}}}`, "disabled apparmor mode is not allowed"},
+		{`{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"nginx"},"Networks":[{"Target":"host"}]}}`, "host network mode is not allowed"},
+		{`{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"nginx"}},"Networks":[{"Target":"host"}]}`, "host network mode is not allowed"},
+		{`{"Name":"web","TaskTemplate":{"Runtime":"plugin","PluginSpec":{"Name":"evil/plugin"}}}`, "plugin services are not allowed"},
+		{`{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"nginx"},"PluginSpec":null}}`, ""},
+		{``, "service specification is missing in request body"},
+	}
+
+	for _, test := range tests {
+		err := validateServiceSpec(policy, []byte(test.body))
+		if test.expectedReason == "" {
+			assert.NoError(t, err, test.body)
+		} else if assert.Error(t, err, test.body) {
+			assert.Equal(t, test.expectedReason, err.Error(), test.body)
+		}
+	}
+}
+
+func TestServicePolicyApply(t *testing.T) {
+
+	policy := `{"name":"ops","users":["alice"],"actions":["service"],"container":{},"volume":{},"image":{"registries":["registry.local"]}}`
+
+	const policyFileName = "/tmp/policy_service.json"
+	err := ioutil.WriteFile(policyFileName, []byte(policy), 0755)
+	assert.NoError(t, err)
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyFileName})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	tests := []struct {
+		uri   string
+		body  string
+		allow bool
+	}{
+		{"/v1.39/services/create", `{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"registry.local/web:v1"}}}`, true},
+		{"/v1.39/services/create", `{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"evil.io/web:v1"}}}`, false},                                                                                                                                              // Registry not allowed
+		{"/v1.39/services/create", `{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"registry.local/web:v1","Mounts":[{"Type":"bind","Source":"/","Target":"/h"}]}}}`, false},                                                                                 // Bind mount not allowed
+		{"/v1.39/services/web/update?version=10", `{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"registry.local/web:v1","CapabilityAdd":["ALL"]}}}`, false},                                                                                                // Capability not allowed
+		{"/v1.39/services/web/update?version=10", `{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"registry.local/web:v1","Mounts":[{"Type":"volume","Target":"/etc","VolumeOptions":{"DriverConfig":{"Options":{"o":"bind","device":"/etc"}}}}]}}}`, false}, // Volume bind not allowed
+		{"/v1.39/services/web/update?version=10", `{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"registry.local/web:v2"}}}`, true},
+	}
+
+	for _, test := range tests {
+		res := authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodPost, RequestURI: test.uri, User: "alice", RequestBody: []byte(test.body)})
+		assert.Equal(t, test.allow, res.Allow, "Request %s %s must be allowed/denied based on policy: %s", test.uri, test.body, res.Msg)
+	}
+}
@@ -0,0 +1,103 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/api/types/mount"
+	"path"
+	"strings"
+)
+
+// localVolumeDriver is the built in volume driver, which mounts host paths, devices or remote file systems according to its options
+const localVolumeDriver = "local"
+
+// VolumePolicy restricts the volumes that can be created in volume_create, and the volumes created by container_create mounts.
+// Local volumes that bind host paths or mount file systems are host mounts, so they are restricted as well as the volume driver
+type VolumePolicy struct {
+	Drivers    []string `json:"drivers"`     // Drivers are the volume driver patterns that can be used (only the local driver if empty)
+	BindMounts []string `json:"bind_mounts"` // BindMounts are the host path patterns local volumes can bind (e.g., /srv/data/*)
+	MountTypes []string `json:"mount_types"` // MountTypes are the file system types local volumes can mount (e.g., tmpfs or nfs)
+
+	patternSet // patternSet holds the compiled policy patterns, set when the policy is validated
+}
+
+// volumeCreateConfig is the volume create request body
+type volumeCreateConfig struct {
+	Name       string            `json:"Name"`
+	Driver     string            `json:"Driver"`
+	DriverOpts map[string]string `json:"DriverOpts"`
+}
+
+// validateVolumeCreate validates the volume create request body against the volume policy
+func validateVolumeCreate(policy *VolumePolicy, body []byte) error {
+	// Docker client sends a body, an empty volume configuration is the default local volume
+	config := volumeCreateConfig{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &config); err != nil {
+			return fmt.Errorf("invalid volume configuration: %s", err.Error())
+		}
+	}
+	return validateVolume(policy, config.Driver, config.DriverOpts)
+}
+
+// validateContainerVolumes validates the volumes created by the container create request mounts against the volume policy
+func validateContainerVolumes(policy *VolumePolicy, body []byte) error {
+	config, err := decodeContainerCreate(body)
+	if err != nil {
+		return err
+	}
+
+	hostConfig := config.hostConfig()
+	if hostConfig == nil {
+		return nil
+	}
+	if hostConfig.VolumeDriver != "" {
+		if err := validateVolume(policy, hostConfig.VolumeDriver, nil); err != nil {
+			return err
+		}
+	}
+	for _, m := range hostConfig.Mounts {
+		if m.Type != mount.TypeVolume || m.VolumeOptions == nil || m.VolumeOptions.DriverConfig == nil {
+			continue
+		}
+		if err := validateVolume(policy, m.VolumeOptions.DriverConfig.Name, m.VolumeOptions.DriverConfig.Options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateVolume validates the volume driver and driver options against the volume policy
+func validateVolume(policy *VolumePolicy, driver string, opts map[string]string) error {
+	if driver == "" {
+		driver = localVolumeDriver
+	}
+
+	drivers := policy.Drivers
+	if len(drivers) == 0 {
+		drivers = []string{localVolumeDriver}
+	}
+	if !policy.matchAny(drivers, driver) {
+		return fmt.Errorf("volume driver '%s' is not allowed", driver)
+	}
+
+	if driver != localVolumeDriver || len(opts) == 0 {
+		return nil
+	}
+
+	// Bind local volumes mount a host path, the same as bind mounts
+	for _, option := range strings.Split(opts["o"], ",") {
+		if option == "bind" || option == "rbind" {
+			device := opts["device"]
+			if !strings.HasPrefix(device, "/") || !policy.matchAny(policy.BindMounts, path.Clean(device)) {
+				return fmt.Errorf("volume bind of '%s' is not allowed", device)
+			}
+			return nil
+		}
+	}
+
+	if mountType := opts["type"]; mountType != "" && !policy.matchAny(policy.MountTypes, mountType) {
+		return fmt.Errorf("volume mount type '%s' is not allowed", mountType)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package authz
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidateVolumeCreate(t *testing.T) {
+
+	policy := &VolumePolicy{
+		Drivers:    []string{"local", "rexray/*"},
+		BindMounts: []string{"/srv/data/*"},
+		MountTypes: []string{"tmpfs"},
+	}
+
+	tests := []struct {
+		body           string
+		expectedReason string // expectedReason is the expected denial reason, empty if the request is allowed
+	}{
+		{``, ""},
+		{`{"Name":"data"}`, ""},
+		{`{"Name":"data","Driver":"rexray/ebs"}`, ""},
+		{`{"Name":"data","Driver":"sshfs"}`, "volume driver 'sshfs' is not allowed"},
+		{`{"Name":"data","DriverOpts":{"type":"none","o":"bind","device":"/srv/data/app"}}`, ""},
+		{`{"Name":"data","DriverOpts":{"type":"none","o":"bind","device":"/etc"}}`, "volume bind of '/etc' is not allowed"},
+		{`{"Name":"data","DriverOpts":{"type":"none","o":"ro,rbind","device":"/srv/data/../../etc"}}`, "volume bind of '/srv/data/../../etc' is not allowed"},
+		{`{"Name":"data","DriverOpts":{"type":"tmpfs","device":"tmpfs","o":"size=100m"}}`, ""},
+		{`{"Name":"data","DriverOpts":{"type":"ext4","device":"/dev/sda1"}}`, "volume mount type 'ext4' is not allowed"},
+		{`{"Name":"data","DriverOpts":{"type":"nfs","o":"addr=10.0.0.1","device":":/export"}}`, "volume mount type 'nfs' is not allowed"},
+		{`{"Name":`, "invalid volume configuration: unexpected end of JSON input"},
+	}
+
+	for _, test := range tests {
+		err := validateVolumeCreate(policy, []byte(test.body))
+		if test.expectedReason == "" {
+			assert.NoError(t, err, test.body)
+		} else if assert.Error(t, err, test.body) {
+			assert.Equal(t, test.expectedReason, err.Error(), test.body)
+		}
+	}
+
+	assert.Error(t, validateVolumeCreate(&VolumePolicy{}, []byte(`{"Driver":"rexray/ebs"}`)), "Only local driver must be allowed by default")
+}
+
+func TestValidateContainerVolumes(t *testing.T) {
+
+	policy := &VolumePolicy{}
+
+	tests := []struct {
+		body           string
+		expectedReason string // expectedReason is the expected denial reason, empty if the request is allowed
+	}{
+		{`{"Image":"busybox","HostConfig":{"Binds":["data:/data"]}}`, ""},
+		{`{"Image":"busybox","HostConfig":{"Mounts":[{"Type":"volume","Source":"data","Target":"/data"}]}}`, ""},
+		{`{"Image":"busybox","HostConfig":{"Mounts":[{"Type":"volume","Target":"/data","VolumeOptions":{"DriverConfig":{"Name":"local","Options":{"type":"none","o":"bind","device":"/"}}}}]}}`, "volume bind of '/' is not allowed"},
+		{`{"Image":"busybox","HostConfig":{"VolumeDriver":"sshfs","Binds":["data:/data"]}}`, "volume driver 'sshfs' is not allowed"},
+	}
+
+	for _, test := range tests {
+		err := validateContainerVolumes(policy, []byte(test.body))
+		if test.expectedReason == "" {
+			assert.NoError(t, err, test.body)
+		} else if assert.Error(t, err, test.body) {
+			assert.Equal(t, test.expectedReason, err.Error(), test.body)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package authz
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/howeyc/fsnotify"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// reloadDelay is the time to wait for file changes to settle before reloading,
+// since editors and atomic writers generate several events for a single change
+var reloadDelay = 100 * time.Millisecond
+
+// rewatchDelay is the time to wait before watching a directory again, after the watched directory is removed
+var rewatchDelay = time.Second
+
+// watchFile reloads the file (or directory) whenever it is modified.
+// The directory of a file is watched rather than the file itself, so the file is reloaded even when it is replaced,
+// e.g., by editors that rename a new file over the old one, or by Kubernetes ConfigMap volumes that swap the ..data link
+func watchFile(path string, reload func() error) error {
+	dir, file := path, ""
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		dir, file = filepath.Dir(path), filepath.Base(path)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		var pending <-chan time.Time
+		for {
+			select {
+			case ev := <-watcher.Event:
+				if !watchedEvent(dir, file, ev) {
+					continue
+				}
+				pending = time.After(reloadDelay)
+			case <-pending:
+				pending = nil
+				// The directory itself might have been replaced, watching it again is a no-op if it was not
+				if err := watcher.Watch(dir); err != nil {
+					logrus.Errorf("Failed to watch %q %q", dir, err.Error())
+					pending = time.After(rewatchDelay)
+					continue
+				}
+				if err := reload(); err != nil {
+					logrus.Errorf("Error refreshing %q %q", path, err.Error())
+				}
+			case err := <-watcher.Error:
+				logrus.Errorf("Settings watcher error '%v'", err)
+			}
+		}
+	}()
+
+	err = watcher.Watch(dir)
+	if err != nil {
+		// Silently ignore watching error
+		logrus.Errorf("Failed to start watching folder %q", err.Error())
+	}
+
+	return nil
+}
+
+// watchedEvent checks whether the event affects the watched file, or any file if the whole directory is watched.
+// Changes to hidden entries (e.g., the ..data link of a ConfigMap volume) can replace the file as well
+func watchedEvent(dir, file string, ev *fsnotify.FileEvent) bool {
+	if file == "" || ev.Name == dir {
+		return true
+	}
+	name := filepath.Base(ev.Name)
+	return name == file || strings.HasPrefix(name, "..")
+}
+
+// reloadOnSignal reloads the file whenever the process receives SIGHUP
+func reloadOnSignal(path string, reload func() error) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			logrus.Infof("Reloading %q", path)
+			if err := reload(); err != nil {
+				logrus.Errorf("Error refreshing %q %q", path, err.Error())
+			}
+		}
+	}()
+}
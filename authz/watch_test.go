@@ -0,0 +1,140 @@
+package authz
+
+import (
+	"fmt"
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+	"github.com/twistlock/authz/core"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// waitFor waits until the condition holds, and returns whether it held before the timeout
+func waitFor(condition func() bool) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if condition() {
+			return true
+		}
+	}
+	return false
+}
+
+// userAllowed returns whether the user is allowed to list containers
+func userAllowed(authorizer core.Authorizer, user string) bool {
+	return authorizer.AuthZReq(&authorization.Request{RequestMethod: http.MethodGet, RequestURI: "/v1.40/containers/json", User: user}).Allow
+}
+
+// userPolicy returns a policy file that allows the user to list containers
+func userPolicy(user string) []byte {
+	return []byte(fmt.Sprintf("- name: %s\n  users: [%s]\n  actions: [container_list]\n", user, user))
+}
+
+func TestWatchReplacedPolicyFile(t *testing.T) {
+
+	const dir = "/tmp/policy_watch"
+	writePolicyDir(t, dir, map[string]string{"policy.yaml": string(userPolicy("alice"))})
+	policyPath := filepath.Join(dir, "policy.yaml")
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyPath})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+	assert.True(t, userAllowed(authorizer, "alice"))
+
+	// Editors and atomic writers rename a new file over the policy file
+	tmpPath := filepath.Join(dir, "policy.yaml.tmp")
+	assert.NoError(t, ioutil.WriteFile(tmpPath, userPolicy("bob"), 0644))
+	assert.NoError(t, os.Rename(tmpPath, policyPath))
+	assert.True(t, waitFor(func() bool { return userAllowed(authorizer, "bob") }), "Replaced policy file must be reloaded")
+	assert.False(t, userAllowed(authorizer, "alice"))
+
+	// The policy file is still watched after it is deleted and created again
+	assert.NoError(t, os.Remove(policyPath))
+	assert.NoError(t, ioutil.WriteFile(policyPath, userPolicy("carol"), 0644))
+	assert.True(t, waitFor(func() bool { return userAllowed(authorizer, "carol") }), "Recreated policy file must be reloaded")
+	assert.False(t, userAllowed(authorizer, "bob"))
+}
+
+func TestWatchConfigMapPolicyFile(t *testing.T) {
+
+	// A ConfigMap volume links each file to the ..data link, which is swapped to a new data directory upon update
+	const dir = "/tmp/policy_configmap"
+	writePolicyDir(t, dir, map[string]string{"..2020_01/policy.yaml": string(userPolicy("alice"))})
+	assert.NoError(t, os.Symlink("..2020_01", filepath.Join(dir, "..data")))
+	assert.NoError(t, os.Symlink("..data/policy.yaml", filepath.Join(dir, "policy.yaml")))
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: filepath.Join(dir, "policy.yaml")})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+	assert.True(t, userAllowed(authorizer, "alice"))
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "..2020_02"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "..2020_02", "policy.yaml"), userPolicy("bob"), 0644))
+	assert.NoError(t, os.Symlink("..2020_02", filepath.Join(dir, "..data_tmp")))
+	assert.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	assert.NoError(t, os.RemoveAll(filepath.Join(dir, "..2020_01")))
+
+	assert.True(t, waitFor(func() bool { return userAllowed(authorizer, "bob") }), "Swapped ConfigMap data must be reloaded")
+	assert.False(t, userAllowed(authorizer, "alice"))
+}
+
+func TestWatchPolicyDirectory(t *testing.T) {
+
+	const dir = "/tmp/policy_watch_dir"
+	writePolicyDir(t, dir, map[string]string{"10-alice.yaml": string(userPolicy("alice"))})
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: dir})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+	assert.False(t, userAllowed(authorizer, "bob"))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "20-bob.yaml"), userPolicy("bob"), 0644))
+	assert.True(t, waitFor(func() bool { return userAllowed(authorizer, "bob") }), "Created policy file must be loaded")
+
+	assert.NoError(t, os.Remove(filepath.Join(dir, "10-alice.yaml")))
+	assert.True(t, waitFor(func() bool { return !userAllowed(authorizer, "alice") }), "Deleted policy file must be unloaded")
+}
+
+func TestReloadOnSignal(t *testing.T) {
+
+	reloaded := make(chan struct{}, 1)
+	reloadOnSignal("test", func() error {
+		reloaded <- struct{}{}
+		return nil
+	})
+
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "SIGHUP must trigger a reload")
+	}
+}
+
+func TestConcurrentPolicyReload(t *testing.T) {
+
+	const policyPath = "/tmp/policy_concurrent.yaml"
+	assert.NoError(t, ioutil.WriteFile(policyPath, []byte("- name: ops\n  users: [alice, bob]\n  actions: [container_list]\n"), 0644))
+
+	authorizer := NewBasicAuthZAuthorizer(&BasicAuthorizerSettings{PolicyPath: policyPath})
+	assert.NoError(t, authorizer.Init(), "Initialization must be succesfull")
+
+	// Requests are evaluated while the policies are reloaded, each request sees a complete policy set
+	var wg sync.WaitGroup
+	for _, user := range []string{"alice", "bob"} {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				assert.True(t, userAllowed(authorizer, user))
+				authorizer.AuthZRes(&authorization.Request{RequestMethod: http.MethodGet, RequestURI: "/v1.40/containers/json", User: user, ResponseBody: []byte("[]")})
+			}
+		}(user)
+	}
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, authorizer.(*basicAuthorizer).loadPolicies())
+	}
+	wg.Wait()
+}
@@ -4,6 +4,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
@@ -17,6 +18,14 @@ const (
 	auditorFlag     = "auditor"
 	auditorHookFlag = "auditor-hook"
 	policyFileFlag  = "policy-file"
+	groupFileFlag   = "group-file"
+	certGroupsFlag  = "cert-groups"
+	principalFlag   = "principal-fields"
+	issuersFlag     = "trusted-issuers"
+	issuerCAFlag    = "issuer-ca-file"
+	modeFlag        = "mode"
+	ownershipFlag   = "ownership-file"
+	secretsFlag     = "secret-patterns"
 )
 
 const (
@@ -39,24 +48,59 @@ func main() {
 
 		initLogger(c.GlobalBool(debugFlag))
 
+		var principalFields []string
+		if c.GlobalString(principalFlag) != "" {
+			principalFields = strings.Split(c.GlobalString(principalFlag), ",")
+		}
+
 		var auditor core.Auditor
 		var authZHandler core.Authorizer
 
-		switch c.GlobalString(authorizerFlag) {
-		case authorizerBasic:
-			authZHandler = authz.NewBasicAuthZAuthorizer(&authz.BasicAuthorizerSettings{PolicyPath: c.GlobalString(policyFileFlag)})
+		switch c.GlobalString(auditorFlag) {
+		case auditorBasic:
+			auditor = authz.NewBasicAuditor(&authz.BasicAuditorSettings{LogHook: c.GlobalString(auditorHookFlag), PrincipalFields: principalFields})
 		default:
 			panic(fmt.Sprintf("Unknown authz handler %q", c.GlobalString(authorizerFlag)))
 		}
 
-		switch c.GlobalString(auditorFlag) {
-		case auditorBasic:
-			auditor = authz.NewBasicAuditor(&authz.BasicAuditorSettings{LogHook: c.GlobalString(auditorHookFlag)})
+		// Auditors that support events audit the authorizer failures, e.g., invalid policies
+		eventAuditor, _ := auditor.(core.EventAuditor)
+
+		switch c.GlobalString(authorizerFlag) {
+		case authorizerBasic:
+			var groupResolvers []core.GroupResolver
+			if c.GlobalString(groupFileFlag) != "" {
+				groupResolvers = append(groupResolvers, authz.NewFileGroupResolver(&authz.FileGroupResolverSettings{GroupPath: c.GlobalString(groupFileFlag)}))
+			}
+			if c.GlobalBool(certGroupsFlag) {
+				groupResolvers = append(groupResolvers, authz.NewCertGroupResolver())
+			}
+
+			var trustedIssuers []string
+			if c.GlobalString(issuersFlag) != "" {
+				trustedIssuers = strings.Split(c.GlobalString(issuersFlag), ",")
+			}
+
+			var secretPatterns []string
+			if c.GlobalString(secretsFlag) != "" {
+				secretPatterns = strings.Split(c.GlobalString(secretsFlag), ",")
+			}
+
+			authZHandler = authz.NewBasicAuthZAuthorizer(&authz.BasicAuthorizerSettings{
+				PolicyPath:      c.GlobalString(policyFileFlag),
+				GroupResolver:   authz.NewMultiGroupResolver(groupResolvers...),
+				PrincipalFields: principalFields,
+				TrustedIssuers:  trustedIssuers,
+				IssuerCAPath:    c.GlobalString(issuerCAFlag),
+				OwnershipPath:   c.GlobalString(ownershipFlag),
+				SecretPatterns:  secretPatterns,
+				EventAuditor:    eventAuditor,
+			})
 		default:
 			panic(fmt.Sprintf("Unknown authz handler %q", c.GlobalString(authorizerFlag)))
 		}
 
-		srv := core.NewAuthZSrv(authZHandler, auditor)
+		srv := core.NewAuthZSrvWithMode(authZHandler, auditor, c.GlobalString(modeFlag))
 		err := srv.Start()
 
 		if err != nil {
@@ -82,7 +126,57 @@ func main() {
 			Name:   policyFileFlag,
 			Value:  "/var/lib/authz-broker/policy.json",
 			EnvVar: "AUTHZ-POLICY-FILE",
-			Usage:  "Defines the authz policy file for basic handler",
+			Usage:  "Defines the authz policy file (or directory of policy files) for basic handler",
+		},
+
+		cli.StringFlag{
+			Name:   groupFileFlag,
+			EnvVar: "AUTHZ-GROUP-FILE",
+			Usage:  "Defines the group file (JSON or YAML) used to resolve user groups for basic handler",
+		},
+
+		cli.BoolFlag{
+			Name:   certGroupsFlag,
+			EnvVar: "AUTHZ-CERT-GROUPS",
+			Usage:  "Resolve user groups from the organizational unit (OU) and organization (O) of the client certificate",
+		},
+
+		cli.StringFlag{
+			Name:   principalFlag,
+			EnvVar: "AUTHZ-PRINCIPAL-FIELDS",
+			Usage:  "Defines the comma separated client certificate fields (cn,email,uri,dns,ou,o,issuer) used by policies and audit (all fields if empty)",
+		},
+
+		cli.StringFlag{
+			Name:   issuersFlag,
+			EnvVar: "AUTHZ-TRUSTED-ISSUERS",
+			Usage:  "Defines the comma separated SHA-256 fingerprints of the CA certificates allowed to issue client certificates (any CA if empty)",
+		},
+
+		cli.StringFlag{
+			Name:   issuerCAFlag,
+			EnvVar: "AUTHZ-ISSUER-CA-FILE",
+			Usage:  "Defines the PEM file of CA certificates that clients do not send in the certificate chain (e.g., root CAs), used to verify issuers",
+		},
+
+		cli.StringFlag{
+			Name:   ownershipFlag,
+			Value:  "/var/lib/authz-broker/ownership.json",
+			EnvVar: "AUTHZ-OWNERSHIP-FILE",
+			Usage:  "Defines the file used to persist container owners for basic handler",
+		},
+
+		cli.StringFlag{
+			Name:   secretsFlag,
+			EnvVar: "AUTHZ-SECRET-PATTERNS",
+			Usage:  "Defines the comma separated environment variable patterns (e.g., *PASSWORD=*) that container inspect cannot reveal without reveal_secrets",
+		},
+
+		cli.StringFlag{
+			Name:   modeFlag,
+			Value:  core.ModeEnforce,
+			EnvVar: "AUTHZ-MODE",
+			Usage:  "Defines the enforcement mode, enforce or monitor (all requests are allowed, requests that would be denied are audited)",
 		},
 
 		cli.StringFlag{
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"github.com/docker/docker/pkg/authorization"
+	"io/ioutil"
+	"strings"
+)
+
+var (
+	// PrincipalCommonName is the client certificate subject common name (CN)
+	PrincipalCommonName = "cn"
+	// PrincipalEmail is the client certificate subject alternative name email addresses
+	PrincipalEmail = "email"
+	// PrincipalURI is the client certificate subject alternative name URIs (e.g., spiffe://corp/role/ops)
+	PrincipalURI = "uri"
+	// PrincipalDNS is the client certificate subject alternative name DNS names
+	PrincipalDNS = "dns"
+	// PrincipalOrganizationalUnit is the client certificate subject organizational units (OU)
+	PrincipalOrganizationalUnit = "ou"
+	// PrincipalOrganization is the client certificate subject organizations (O)
+	PrincipalOrganization = "o"
+	// PrincipalIssuer is the SHA-256 fingerprints of the certificates that issued the client certificate (see VerifiedIssuers)
+	PrincipalIssuer = "issuer"
+)
+
+// PrincipalFields are all the client certificate fields that can be extracted into a principal
+var PrincipalFields = []string{
+	PrincipalCommonName,
+	PrincipalEmail,
+	PrincipalURI,
+	PrincipalDNS,
+	PrincipalOrganizationalUnit,
+	PrincipalOrganization,
+	PrincipalIssuer,
+}
+
+// Principal is the identity of the client that sent the request to docker daemon
+type Principal struct {
+	User       string              // User is the request user, as extracted by docker daemon (the certificate common name)
+	Attributes map[string][]string // Attributes are the client certificate fields values, keyed by field (e.g., ou)
+}
+
+// IdentityExtractor builds the request principal from configurable client certificate fields
+type IdentityExtractor struct {
+	fields    []string
+	issuerCAs []*x509.Certificate
+}
+
+// NewIdentityExtractor creates a new identity extractor that extracts the given client certificate fields,
+// all the supported fields are extracted if no fields are given.
+// The issuer CAs are additional CA certificates, which clients usually do not send, that can be identified as issuers
+func NewIdentityExtractor(fields []string, issuerCAs []*x509.Certificate) (*IdentityExtractor, error) {
+	if len(fields) == 0 {
+		return &IdentityExtractor{fields: PrincipalFields, issuerCAs: issuerCAs}, nil
+	}
+
+	for _, field := range fields {
+		supported := false
+		for _, principalField := range PrincipalFields {
+			if field == principalField {
+				supported = true
+			}
+		}
+		if !supported {
+			return nil, fmt.Errorf("unsupported principal field '%s'", field)
+		}
+	}
+	return &IdentityExtractor{fields: fields, issuerCAs: issuerCAs}, nil
+}
+
+// Principal builds the principal of the request, attributes are empty if the request has no client certificate
+func (e *IdentityExtractor) Principal(req *authorization.Request) *Principal {
+	return e.principal(req, func() []string { return VerifiedIssuers(req, e.issuerCAs) })
+}
+
+// PrincipalWithIssuers builds the principal of the request given the request verified issuers,
+// so callers that already verified the issuers (see VerifiedIssuers) do not verify the certificate chain again
+func (e *IdentityExtractor) PrincipalWithIssuers(req *authorization.Request, issuers []string) *Principal {
+	return e.principal(req, func() []string { return issuers })
+}
+
+// principal builds the principal of the request, the issuers are only computed if the issuer field is extracted
+func (e *IdentityExtractor) principal(req *authorization.Request, issuers func() []string) *Principal {
+	principal := &Principal{User: req.User, Attributes: make(map[string][]string)}
+	certs := PeerCertificates(req)
+	if len(certs) == 0 {
+		return principal
+	}
+
+	leaf := certs[0]
+	for _, field := range e.fields {
+		var values []string
+		switch field {
+		case PrincipalCommonName:
+			if leaf.Subject.CommonName != "" {
+				values = []string{leaf.Subject.CommonName}
+			}
+		case PrincipalEmail:
+			values = leaf.EmailAddresses
+		case PrincipalURI:
+			for _, uri := range leaf.URIs {
+				values = append(values, uri.String())
+			}
+		case PrincipalDNS:
+			values = leaf.DNSNames
+		case PrincipalOrganizationalUnit:
+			values = leaf.Subject.OrganizationalUnit
+		case PrincipalOrganization:
+			values = leaf.Subject.Organization
+		case PrincipalIssuer:
+			values = issuers()
+		}
+		if len(values) > 0 {
+			principal.Attributes[field] = values
+		}
+	}
+	return principal
+}
+
+// PeerCertificates returns the request TLS peer certificates, where the first certificate is the client certificate
+func PeerCertificates(req *authorization.Request) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for _, cert := range req.RequestPeerCertificates {
+		if cert != nil {
+			certs = append(certs, (*x509.Certificate)(cert))
+		}
+	}
+	return certs
+}
+
+// CertificateFingerprint returns the hex encoded SHA-256 fingerprint of the certificate
+func CertificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeFingerprint converts a certificate fingerprint to the canonical form (lower case hex without separators)
+func NormalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.Replace(fingerprint, ":", "", -1))
+}
+
+// VerifiedIssuers returns the fingerprints of the certificates that issued the request client certificate, ordered from the direct issuer.
+// Issuers are looked up in the request chain and in the given CA certificates (e.g., root CAs that clients do not send).
+// Since the chain is sent by the client, only issuers whose signature chain from the client certificate is verified are returned
+func VerifiedIssuers(req *authorization.Request, cas []*x509.Certificate) []string {
+	certs := PeerCertificates(req)
+	if len(certs) == 0 {
+		return nil
+	}
+
+	var candidates []*x509.Certificate
+	candidates = append(candidates, certs[1:]...)
+	candidates = append(candidates, cas...)
+	used := make([]bool, len(candidates))
+	var fingerprints []string
+	current := certs[0]
+	for {
+		issuer := -1
+		for i := 0; i < len(candidates) && issuer < 0; i++ {
+			if !used[i] && current.CheckSignatureFrom(candidates[i]) == nil {
+				issuer = i
+			}
+		}
+		if issuer < 0 {
+			return fingerprints
+		}
+		used[issuer] = true
+		current = candidates[issuer]
+		fingerprints = append(fingerprints, CertificateFingerprint(current))
+	}
+}
+
+// LoadCertificates loads the PEM encoded certificates from the given file
+func LoadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate in %q: %s", path, err.Error())
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in %q", path)
+	}
+	return certs, nil
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentityExtractor(t *testing.T) {
+
+	root, rootKey := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "root"}, IsCA: true}, nil, nil)
+	intermediate, intermediateKey := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "intermediate"}, IsCA: true}, root, rootKey)
+	other, _ := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "intermediate"}, IsCA: true}, root, rootKey)
+	spiffe, _ := url.Parse("spiffe://corp/role/ops")
+	leaf, _ := newTestCertificate(t, &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"ops"}, Organization: []string{"acme"}},
+		EmailAddresses: []string{"alice@acme.io"},
+		DNSNames:       []string{"alice.acme.io"},
+		URIs:           []*url.URL{spiffe},
+	}, intermediate, intermediateKey)
+
+	// The unrelated certificate with the same subject must not be considered an issuer
+	req := &authorization.Request{User: "alice", RequestPeerCertificates: []*authorization.PeerCertificate{
+		(*authorization.PeerCertificate)(leaf),
+		(*authorization.PeerCertificate)(other),
+		(*authorization.PeerCertificate)(intermediate),
+		(*authorization.PeerCertificate)(root),
+	}}
+
+	extractor, err := NewIdentityExtractor(nil, nil)
+	assert.NoError(t, err)
+	principal := extractor.Principal(req)
+	assert.Equal(t, "alice", principal.User)
+	assert.Equal(t, map[string][]string{
+		PrincipalCommonName:         {"alice"},
+		PrincipalEmail:              {"alice@acme.io"},
+		PrincipalURI:                {"spiffe://corp/role/ops"},
+		PrincipalDNS:                {"alice.acme.io"},
+		PrincipalOrganizationalUnit: {"ops"},
+		PrincipalOrganization:       {"acme"},
+		PrincipalIssuer:             {CertificateFingerprint(intermediate), CertificateFingerprint(root)},
+	}, principal.Attributes)
+	assert.Equal(t, []string{"verified"}, extractor.PrincipalWithIssuers(req, []string{"verified"}).Attributes[PrincipalIssuer],
+		"Given issuers must not be verified again")
+
+	extractor, err = NewIdentityExtractor([]string{PrincipalURI, PrincipalOrganizationalUnit}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		PrincipalURI:                {"spiffe://corp/role/ops"},
+		PrincipalOrganizationalUnit: {"ops"},
+	}, extractor.Principal(req).Attributes)
+	assert.Empty(t, extractor.Principal(&authorization.Request{User: "alice"}).Attributes, "Attributes must be empty without client certificate")
+
+	_, err = NewIdentityExtractor([]string{"serial"}, nil)
+	assert.Error(t, err, "Unsupported field must fail")
+}
+
+func TestVerifiedIssuers(t *testing.T) {
+
+	root, rootKey := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "root"}, IsCA: true}, nil, nil)
+	intermediate, intermediateKey := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "intermediate"}, IsCA: true}, root, rootKey)
+	leaf, _ := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}, intermediate, intermediateKey)
+	otherRoot, _ := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "root"}, IsCA: true}, nil, nil)
+
+	// The root is not sent by the client
+	req := &authorization.Request{User: "alice", RequestPeerCertificates: []*authorization.PeerCertificate{
+		(*authorization.PeerCertificate)(leaf),
+		(*authorization.PeerCertificate)(intermediate),
+	}}
+
+	assert.Equal(t, []string{CertificateFingerprint(intermediate)}, VerifiedIssuers(req, nil))
+	assert.Equal(t, []string{CertificateFingerprint(intermediate), CertificateFingerprint(root)}, VerifiedIssuers(req, []*x509.Certificate{otherRoot, root}))
+	assert.Empty(t, VerifiedIssuers(&authorization.Request{User: "alice"}, []*x509.Certificate{root}), "Issuers must be empty without client certificate")
+
+	assert.Equal(t, "ab01cd", NormalizeFingerprint("AB:01:CD"))
+}
+
+func TestLoadCertificates(t *testing.T) {
+
+	root, _ := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "root"}, IsCA: true}, nil, nil)
+	other, _ := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "other"}, IsCA: true}, nil, nil)
+
+	const caFileName = "/tmp/issuer_ca.pem"
+	bundle := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: other.Raw})...)
+	assert.NoError(t, ioutil.WriteFile(caFileName, bundle, 0644))
+
+	certs, err := LoadCertificates(caFileName)
+	if assert.NoError(t, err) && assert.Len(t, certs, 2) {
+		assert.Equal(t, CertificateFingerprint(root), CertificateFingerprint(certs[0]))
+		assert.Equal(t, CertificateFingerprint(other), CertificateFingerprint(certs[1]))
+	}
+
+	const emptyFileName = "/tmp/issuer_ca_empty.pem"
+	assert.NoError(t, ioutil.WriteFile(emptyFileName, []byte("no certificates"), 0644))
+	_, err = LoadCertificates(emptyFileName)
+	assert.Error(t, err, "File without certificates must fail")
+}
+
+// newTestCertificate creates a new certificate from the template, signed by the given parent (self signed if parent is nil)
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.BasicConstraintsValid = true
+	if template.IsCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert, key
+}
@@ -20,3 +20,18 @@ type Auditor interface {
 	// Docker daemon -> authorization  -> audit -> Docker client
 	AuditResponse(req *authorization.Request, pluginRes *authorization.Response) error
 }
+
+// EventAuditor audits events that are not related to a specific docker request (e.g., policy load failures).
+// Auditors can optionally implement it
+type EventAuditor interface {
+	// AuditEvent audits the event with the given fields
+	AuditEvent(event string, fields map[string]interface{}) error
+}
+
+// GroupResolver resolves the groups of the user that sent the request to docker daemon
+type GroupResolver interface {
+	// Init initialize the resolver
+	Init() error
+	// Groups returns the groups the request user belongs to
+	Groups(req *authorization.Request) []string
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"fmt"
+	"github.com/docker/docker/pkg/authorization"
+	"strings"
+)
+
+var (
+	// ModeEnforce indicates authorization decisions are enforced
+	ModeEnforce = "enforce"
+	// ModeMonitor indicates all requests are allowed, and requests that would be denied are only audited
+	ModeMonitor = "monitor"
+)
+
+// WouldDenyPrefix prefixes the message of an allowed response that would have been denied in enforce mode
+const WouldDenyPrefix = "would-deny: "
+
+// ValidateMode checks whether the mode is a supported enforcement mode (empty mode is enforce mode)
+func ValidateMode(mode string) error {
+	if mode != "" && mode != ModeEnforce && mode != ModeMonitor {
+		return fmt.Errorf("unsupported mode '%s'", mode)
+	}
+	return nil
+}
+
+// MonitorResponse converts a deny (or error) response into an allow response whose message records the would-deny decision
+func MonitorResponse(res *authorization.Response) *authorization.Response {
+	if res == nil {
+		return &authorization.Response{Allow: true, Msg: WouldDenyPrefix + "authorization response is nil"}
+	}
+	if res.Allow && res.Err == "" {
+		return res
+	}
+
+	msg := res.Msg
+	if res.Err != "" {
+		msg = strings.TrimSpace(fmt.Sprintf("%s (error: %s)", msg, res.Err))
+	}
+	return &authorization.Response{Allow: true, Msg: WouldDenyPrefix + msg}
+}
+
+// WouldDeny checks whether the response was allowed only because the request is monitored
+func WouldDeny(res *authorization.Response) bool {
+	return res != nil && res.Allow && strings.HasPrefix(res.Msg, WouldDenyPrefix)
+}
@@ -0,0 +1,31 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonitorResponse(t *testing.T) {
+
+	allowed := &authorization.Response{Allow: true, Msg: "action 'docker_version' allowed"}
+	assert.Equal(t, allowed, MonitorResponse(allowed), "Allowed response must not change")
+	assert.False(t, WouldDeny(allowed))
+
+	res := MonitorResponse(&authorization.Response{Allow: false, Msg: "action 'container_create' denied"})
+	assert.True(t, res.Allow)
+	assert.Equal(t, "would-deny: action 'container_create' denied", res.Msg)
+	assert.True(t, WouldDeny(res))
+
+	res = MonitorResponse(&authorization.Response{Err: "invalid request"})
+	assert.True(t, res.Allow)
+	assert.Empty(t, res.Err)
+	assert.Equal(t, "would-deny: (error: invalid request)", res.Msg)
+
+	assert.True(t, WouldDeny(MonitorResponse(nil)))
+
+	assert.NoError(t, ValidateMode(""))
+	assert.NoError(t, ValidateMode(ModeMonitor))
+	assert.Error(t, ValidateMode("audit"))
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultRegistry is the registry of image references that do not specify a registry
+	DefaultRegistry = "docker.io"
+	// defaultRepositoryPrefix is the repository prefix of official images in the default registry
+	defaultRepositoryPrefix = "library/"
+	// legacyDefaultRegistry is an alias of the default registry
+	legacyDefaultRegistry = "index.docker.io"
+)
+
+var (
+	// componentPattern matches a single repository path component
+	componentPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*$`)
+	// tagPattern matches an image tag
+	tagPattern = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	// digestPattern matches an image content digest
+	digestPattern = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-fA-F0-9]{32,}$`)
+	// imageIDPattern matches a full image id, which is not a valid reference
+	imageIDPattern = regexp.MustCompile(`^(?:sha256:)?[a-f0-9]{64}$`)
+)
+
+// ImageReference is a parsed image reference in the form [registry/]repository[:tag][@digest]
+type ImageReference struct {
+	Registry   string // Registry is the registry host (e.g., registry.local:5000), docker.io if not specified
+	Repository string // Repository is the repository path in the registry (e.g., library/busybox)
+	Tag        string // Tag is the image tag, empty if not specified
+	Digest     string // Digest is the image content digest (e.g., sha256:...), empty if not specified
+}
+
+// Name returns the fully qualified repository name (e.g., docker.io/library/busybox)
+func (r *ImageReference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// String returns the fully qualified image reference
+func (r *ImageReference) String() string {
+	ref := r.Name()
+	if r.Tag != "" {
+		ref += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		ref += "@" + r.Digest
+	}
+	return ref
+}
+
+// ParseImageReference parses and normalizes an image reference (e.g., busybox is normalized to docker.io/library/busybox)
+func ParseImageReference(ref string) (*ImageReference, error) {
+	if ref == "" {
+		return nil, fmt.Errorf("image reference is empty")
+	}
+	if imageIDPattern.MatchString(ref) {
+		return nil, fmt.Errorf("image reference '%s' is an image id", ref)
+	}
+
+	var image ImageReference
+	name := ref
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, image.Digest = name[:i], name[i+1:]
+		if !digestPattern.MatchString(image.Digest) {
+			return nil, fmt.Errorf("invalid digest in image reference '%s'", ref)
+		}
+	}
+
+	// The tag separator is the last colon that is not part of the registry host (e.g., registry.local:5000/busybox)
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, image.Tag = name[:i], name[i+1:]
+		if !tagPattern.MatchString(image.Tag) {
+			return nil, fmt.Errorf("invalid tag in image reference '%s'", ref)
+		}
+	}
+
+	image.Registry, image.Repository = DefaultRegistry, name
+	if i := strings.Index(name, "/"); i >= 0 {
+		host := name[:i]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			image.Registry, image.Repository = host, name[i+1:]
+		}
+	}
+	if image.Registry == legacyDefaultRegistry {
+		image.Registry = DefaultRegistry
+	}
+	if image.Registry == DefaultRegistry && !strings.Contains(image.Repository, "/") {
+		image.Repository = defaultRepositoryPrefix + image.Repository
+	}
+
+	for _, component := range strings.Split(image.Repository, "/") {
+		if !componentPattern.MatchString(component) {
+			return nil, fmt.Errorf("invalid repository name in image reference '%s'", ref)
+		}
+	}
+
+	return &image, nil
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseImageReference(t *testing.T) {
+
+	tests := []struct {
+		ref                string
+		expectedRegistry   string
+		expectedRepository string
+		expectedTag        string
+		expectedDigest     string
+	}{
+		{"busybox", "docker.io", "library/busybox", "", ""},
+		{"busybox:1.31", "docker.io", "library/busybox", "1.31", ""},
+		{"twistlock/authz-broker:latest", "docker.io", "twistlock/authz-broker", "latest", ""},
+		{"index.docker.io/busybox", "docker.io", "library/busybox", "", ""},
+		{"registry.local/ci/app", "registry.local", "ci/app", "", ""},
+		{"registry.local:5000/ci/app:v1", "registry.local:5000", "ci/app", "v1", ""},
+		{"localhost/app", "localhost", "app", "", ""},
+		{"registry.local/ci/app@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", "registry.local", "ci/app", "",
+			"sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+		{"app:v1@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", "docker.io", "library/app", "v1",
+			"sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+	}
+
+	for _, test := range tests {
+		ref, err := ParseImageReference(test.ref)
+		if assert.NoError(t, err, test.ref) {
+			assert.Equal(t, test.expectedRegistry, ref.Registry, test.ref)
+			assert.Equal(t, test.expectedRepository, ref.Repository, test.ref)
+			assert.Equal(t, test.expectedTag, ref.Tag, test.ref)
+			assert.Equal(t, test.expectedDigest, ref.Digest, test.ref)
+		}
+	}
+
+	assert.Equal(t, "registry.local:5000/ci/app:v1", mustParseImageReference(t, "registry.local:5000/ci/app:v1").String())
+	assert.Equal(t, "docker.io/library/busybox", mustParseImageReference(t, "busybox").Name())
+
+	for _, ref := range []string{
+		"",
+		"Busybox",
+		"busybox:",
+		"busybox@sha256:xyz",
+		"0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		"sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	} {
+		_, err := ParseImageReference(ref)
+		assert.Error(t, err, "Invalid reference %q must not be parsed", ref)
+	}
+}
+
+func mustParseImageReference(t *testing.T, ref string) *ImageReference {
+	image, err := ParseImageReference(ref)
+	assert.NoError(t, err)
+	return image
+}
@@ -1,198 +1,372 @@
 package core
 
 import (
+	"net/url"
 	"regexp"
+	"sort"
 )
 
 type route struct {
-	pattern string
-	method  string
-	action  string
+	pattern  string // pattern is the path regular expression (without the API version prefix), the resource id (if any) is the first capture group
+	method   string
+	action   string
+	resource string // resource is the kind of object the route refers to
+	// maxVersion is the last API version the route is available in, empty if the route is available in all versions.
+	// Requests in later versions (or without version, which are served in the latest version) are not routed
+	maxVersion string
 }
 
+// RouteInfo is the result of parsing a docker API request
+type RouteInfo struct {
+	Action     string     // Action is the docker action (mapped to authz terminology)
+	Resource   string     // Resource is the kind of object the request refers to (e.g., container or image)
+	ResourceID string     // ResourceID is the object id or name captured from the request path (if any)
+	APIVersion string     // APIVersion is the API version prefix of the request (e.g., 1.21), empty if not specified
+	Query      url.Values // Query holds the request query parameters
+}
+
+// versionPattern matches the API version prefix of a request path (e.g., /v1.21/).
+// The prefix is as lenient as docker router, which also serves malformed versions such as /v1.40./
+var versionPattern = regexp.MustCompile(`^/v([0-9.]+)/`)
+
 var routes = []route{
+	// https://docs.docker.com/engine/api/v1.39/#operation/BuildPrune
+	{pattern: "/build/prune", method: "POST", action: ActionImageBuildPrune, resource: ResourceImage},
+	// BuildKit build cancellation (API 1.38 and above)
+	{pattern: "/build/cancel", method: "POST", action: ActionImageBuildCancel, resource: ResourceImage},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#build-image-from-a-dockerfile
-	{pattern: "/build", method: "POST", action: ActionImageBuild},
+	{pattern: "/build", method: "POST", action: ActionImageBuild, resource: ResourceImage},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.20/#create-a-new-image-from-a-container-s-changes
-	{pattern: "/commit", method: "POST", action: ActionContainerCommit},
+	{pattern: "/commit", method: "POST", action: ActionContainerCommit, resource: ResourceContainer},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.20/#monitor-docker-s-events
 	{pattern: "/events", method: "POST", action: ActionDockerEvents},
+	// https://docs.docker.com/engine/api/v1.30/#operation/SystemEvents
+	{pattern: "/events", method: "GET", action: ActionDockerEvents},
+	// https://docs.docker.com/engine/api/v1.30/#operation/SystemDataUsage
+	{pattern: "/system/df", method: "GET", action: ActionDockerDiskUsage},
+	// https://docs.docker.com/engine/api/v1.39/#operation/Session
+	{pattern: "/session", method: "POST", action: ActionImageBuildSession, resource: ResourceImage},
+	// BuildKit builds gRPC endpoint (API 1.31 and above)
+	{pattern: "/grpc", method: "POST", action: ActionImageBuildGRPC, resource: ResourceImage},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.20/#show-the-docker-version-information
 	{pattern: "/version", method: "GET", action: ActionDockerVersion},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.20/#check-auth-configuration
 	{pattern: "/auth", method: "POST", action: ActionDockerCheckAuth},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#wait-a-container
-	{pattern: "/containers/.+/wait", method: "POST", action: ActionContainerWait},
+	{pattern: "/containers/([^/]+)/wait", method: "POST", action: ActionContainerWait, resource: ResourceContainer},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#resize-a-container-tty
-	{pattern: "/containers/.+/resize", method: "POST", action: ActionContainerResize},
+	{pattern: "/containers/([^/]+)/resize", method: "POST", action: ActionContainerResize, resource: ResourceContainer},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#export-a-container
-	{pattern: "/containers/.+/export", method: "POST", action: ActionContainerExport},
+	{pattern: "/containers/([^/]+)/export", method: "POST", action: ActionContainerExport, resource: ResourceContainer},
+	// https://docs.docker.com/engine/api/v1.30/#operation/ContainerExport
+	{pattern: "/containers/([^/]+)/export", method: "GET", action: ActionContainerExport, resource: ResourceContainer},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#export-a-container
-	{pattern: "/containers/.+/stop", method: "POST", action: ActionContainerStop},
+	{pattern: "/containers/([^/]+)/stop", method: "POST", action: ActionContainerStop, resource: ResourceContainer},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#kill-a-container
-	{pattern: "/containers/.*/kill", method: "POST", action: ActionContainerKill},
+	{pattern: "/containers/([^/]+)/kill", method: "POST", action: ActionContainerKill, resource: ResourceContainer},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#restart-a-container
-	{pattern: "/containers/.+/restart", method: "POST", action: ActionContainerRestart},
+	{pattern: "/containers/([^/]+)/restart", method: "POST", action: ActionContainerRestart, resource: ResourceContainer},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#start-a-container
-	{pattern: "/containers/.+/start", method: "POST", action: ActionContainerStart},
+	{pattern: "/containers/([^/]+)/start", method: "POST", action: ActionContainerStart, resource: ResourceContainer},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#exec-create
-	{pattern: "/containers/.+/exec", method: "POST", action: ActionContainerExecCreate},
+	{pattern: "/containers/([^/]+)/exec", method: "POST", action: ActionContainerExecCreate, resource: ResourceContainer},
+	// https://docs.docker.com/engine/api/v1.30/#operation/ContainerUpdate
+	{pattern: "/containers/([^/]+)/update", method: "POST", action: ActionContainerUpdate, resource: ResourceContainer},
+	// https://docs.docker.com/engine/api/v1.30/#operation/ContainerPrune
+	{pattern: "/containers/prune", method: "POST", action: ActionContainerPrune, resource: ResourceContainer},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#unpause-a-container
-	{pattern: "/containers/.+/unpause", method: "POST", action: ActionContainerUnpause},
+	{pattern: "/containers/([^/]+)/unpause", method: "POST", action: ActionContainerUnpause, resource: ResourceContainer},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#pause-a-container
-	{pattern: "/containers/.+/pause", method: "POST", action: ActionContainerPause},
+	{pattern: "/containers/([^/]+)/pause", method: "POST", action: ActionContainerPause, resource: ResourceContainer},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#copy-files-or-folders-from-a-container
-	{pattern: "/containers/.+/copy", method: "POST", action: ActionContainerCopyFiles},
+	{pattern: "/containers/([^/]+)/copy", method: "POST", action: ActionContainerCopyFiles, resource: ResourceContainer, maxVersion: "1.23"},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#extract-an-archive-of-files-or-folders-to-a-directory-in-a-container
-	{pattern: "/containers/.+/archive", method: "PUT", action: ActionContainerArchiveExtract},
-	{pattern: "/containers/.+/archive", method: "HEAD", action: ActionContainerArchiveInfo},
+	{pattern: "/containers/([^/]+)/archive", method: "PUT", action: ActionContainerArchiveExtract, resource: ResourceContainer},
+	{pattern: "/containers/([^/]+)/archive", method: "HEAD", action: ActionContainerArchiveInfo, resource: ResourceContainer},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#get-an-archive-of-a-filesystem-resource-in-a-container
-	{pattern: "/containers/.+/archive", method: "GET", action: ActionContainerArchive},
+	{pattern: "/containers/([^/]+)/archive", method: "GET", action: ActionContainerArchive, resource: ResourceContainer},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#attach-to-a-container-websocket
-	{pattern: "/containers/.+/attach/ws", method: "GET", action: ActionContainerAttachWs},
+	{pattern: "/containers/([^/]+)/attach/ws", method: "GET", action: ActionContainerAttachWs, resource: ResourceContainer},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#attach-to-a-container
-	{pattern: "/containers/.+/attach", method: "POST", action: ActionContainerAttach},
+	{pattern: "/containers/([^/]+)/attach", method: "POST", action: ActionContainerAttach, resource: ResourceContainer},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#list-containers
-	{pattern: "/containers/json", method: "GET", action: ActionContainerList},
+	{pattern: "/containers/json", method: "GET", action: ActionContainerList, resource: ResourceContainer},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#inspect-a-container
-	{pattern: "/containers/.+/json", method: "GET", action: ActionContainerInspect},
+	{pattern: "/containers/([^/]+)/json", method: "GET", action: ActionContainerInspect, resource: ResourceContainer},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#remove-a-container
-	{pattern: "/containers/.+", method: "DELETE", action: ActionContainerDelete},
+	{pattern: "/containers/([^/]+)", method: "DELETE", action: ActionContainerDelete, resource: ResourceContainer},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#rename-a-container
-	{pattern: "/containers/.+/rename", method: "POST", action: ActionContainerRename},
+	{pattern: "/containers/([^/]+)/rename", method: "POST", action: ActionContainerRename, resource: ResourceContainer},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#get-container-stats-based-on-resource-usage
-	{pattern: "/containers/.+/stats", method: "GET", action: ActionContainerStats},
+	{pattern: "/containers/([^/]+)/stats", method: "GET", action: ActionContainerStats, resource: ResourceContainer},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#inspect-changes-on-a-container-s-filesystem
-	{pattern: "/containers/.+/changes", method: "GET", action: ActionContainerChanges},
+	{pattern: "/containers/([^/]+)/changes", method: "GET", action: ActionContainerChanges, resource: ResourceContainer},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#list-processes-running-inside-a-container
-	{pattern: "/containers/.+/top", method: "GET", action: ActionContainerTop},
+	{pattern: "/containers/([^/]+)/top", method: "GET", action: ActionContainerTop, resource: ResourceContainer},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#get-container-logs
-	{pattern: "/containers/.+/logs", method: "GET", action: ActionContainerLogs},
+	{pattern: "/containers/([^/]+)/logs", method: "GET", action: ActionContainerLogs, resource: ResourceContainer},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#create-a-container
-	{pattern: "/containers/create", method: "POST", action: ActionContainerCreate},
+	{pattern: "/containers/create", method: "POST", action: ActionContainerCreate, resource: ResourceContainer},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#get-a-tarball-containing-all-images
-	{pattern: "/images/.+./get", method: "GET", action: ActionImageArchive},
+	{pattern: "/images/(.+)/get", method: "GET", action: ActionImageArchive, resource: ResourceImage},
+	// https://docs.docker.com/engine/api/v1.30/#operation/ImageGetAll
+	{pattern: "/images/get", method: "GET", action: ActionImageArchive, resource: ResourceImage},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#search-images
-	{pattern: "/images/search", method: "GET", action: ActionImagesSearch},
+	{pattern: "/images/search", method: "GET", action: ActionImagesSearch, resource: ResourceImage},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#tag-an-image-into-a-repository
-	{pattern: "/images/.+/tag", method: "POST", action: ActionImageTag},
+	{pattern: "/images/(.+)/tag", method: "POST", action: ActionImageTag, resource: ResourceImage},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#inspect-an-image
-	{pattern: "/images/.+/json", method: "GET", action: ActionImageInspect},
+	{pattern: "/images/(.+)/json", method: "GET", action: ActionImageInspect, resource: ResourceImage},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.18/#inspect-an-image
-	{pattern: "/images/.+", method: "DELETE", action: ActionImageDelete},
+	{pattern: "/images/(.+)", method: "DELETE", action: ActionImageDelete, resource: ResourceImage},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#get-the-history-of-an-image
-	{pattern: "/images/.+/history", method: "GET", action: ActionImageHistory},
+	{pattern: "/images/(.+)/history", method: "GET", action: ActionImageHistory, resource: ResourceImage},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#push-an-image-on-the-registry
-	{pattern: "/images/.+/push", method: "POST", action: ActionImagePush},
+	{pattern: "/images/(.+)/push", method: "POST", action: ActionImagePush, resource: ResourceImage},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#create-an-image
-	{pattern: "/images/create", method: "POST", action: ActionImageCreate},
+	{pattern: "/images/create", method: "POST", action: ActionImageCreate, resource: ResourceImage},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#load-a-tarball-with-a-set-of-images-and-tags-into-docker
-	{pattern: "/images/load", method: "POST", action: ActionImageLoad},
+	{pattern: "/images/load", method: "POST", action: ActionImageLoad, resource: ResourceImage},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#list-images
-	{pattern: "/images/json", method: "GET", action: ActionImageList},
+	{pattern: "/images/json", method: "GET", action: ActionImageList, resource: ResourceImage},
 	// https://docs.docker.com/engine/api/v1.37/#operation/ImagePrune
-	{pattern: "/images/prune", method: "POST", action: ActionImagePrune},
+	{pattern: "/images/prune", method: "POST", action: ActionImagePrune, resource: ResourceImage},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#ping-the-docker-server
 	{pattern: "/_ping", method: "GET", action: ActionDockerPing},
+	// https://docs.docker.com/engine/api/v1.40/#operation/SystemPingHead
+	{pattern: "/_ping", method: "HEAD", action: ActionDockerPing},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#display-system-wide-information
 	{pattern: "/info", method: "GET", action: ActionDockerInfo},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#exec-inspect
-	{pattern: "/exec/.+/json", method: "GET", action: ActionContainerExecInspect},
+	{pattern: "/exec/([^/]+)/json", method: "GET", action: ActionContainerExecInspect, resource: ResourceExec},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#exec-start
-	{pattern: "/exec/.+/start", method: "POST", action: ActionContainerExecStart},
+	{pattern: "/exec/([^/]+)/start", method: "POST", action: ActionContainerExecStart, resource: ResourceExec},
+	// https://docs.docker.com/engine/api/v1.30/#operation/ExecResize
+	{pattern: "/exec/([^/]+)/resize", method: "POST", action: ActionContainerExecResize, resource: ResourceExec},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#inspect-a-volume
-	{pattern: "/volumes/.+", method: "GET", action: ActionVolumeInspect},
+	{pattern: "/volumes/([^/]+)", method: "GET", action: ActionVolumeInspect, resource: ResourceVolume},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#list-volumes
-	{pattern: "/volumes", method: "GET", action: ActionVolumeList},
+	{pattern: "/volumes", method: "GET", action: ActionVolumeList, resource: ResourceVolume},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#create-a-volume
-	{pattern: "/volumes/create", method: "POST", action: ActionVolumeCreate},
+	{pattern: "/volumes/create", method: "POST", action: ActionVolumeCreate, resource: ResourceVolume},
+	// https://docs.docker.com/engine/api/v1.30/#operation/VolumePrune
+	{pattern: "/volumes/prune", method: "POST", action: ActionVolumePrune, resource: ResourceVolume},
+	// https://docs.docker.com/engine/api/v1.42/#operation/VolumeUpdate
+	{pattern: "/volumes/([^/]+)", method: "PUT", action: ActionVolumeUpdate, resource: ResourceVolume},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#remove-a-volume
-	{pattern: "/volumes/.+", method: "DELETE", action: ActionVolumeRemove},
+	{pattern: "/volumes/([^/]+)", method: "DELETE", action: ActionVolumeRemove, resource: ResourceVolume},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#inspect-network
-	{pattern: "/networks/.+", method: "GET", action: ActionNetworkInspect},
+	{pattern: "/networks/([^/]+)", method: "GET", action: ActionNetworkInspect, resource: ResourceNetwork},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#list-networks
-	{pattern: "/networks", method: "GET", action: ActionNetworkList},
+	{pattern: "/networks", method: "GET", action: ActionNetworkList, resource: ResourceNetwork},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#create-a-network
-	{pattern: "/networks/create", method: "POST", action: ActionNetworkCreate},
+	{pattern: "/networks/create", method: "POST", action: ActionNetworkCreate, resource: ResourceNetwork},
+	// https://docs.docker.com/engine/api/v1.30/#operation/NetworkPrune
+	{pattern: "/networks/prune", method: "POST", action: ActionNetworkPrune, resource: ResourceNetwork},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#connect-a-container-to-a-network
-	{pattern: "/networks/.+/connect", method: "POST", action: ActionNetworkConnect},
+	{pattern: "/networks/([^/]+)/connect", method: "POST", action: ActionNetworkConnect, resource: ResourceNetwork},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#disconnect-a-container-from-a-network
-	{pattern: "/networks/.+/disconnect", method: "POST", action: ActionNetworkDisconnect},
+	{pattern: "/networks/([^/]+)/disconnect", method: "POST", action: ActionNetworkDisconnect, resource: ResourceNetwork},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#remove-a-network
-	{pattern: "/networks/.+", method: "DELETE", action: ActionNetworkRemove},
+	{pattern: "/networks/([^/]+)", method: "DELETE", action: ActionNetworkRemove, resource: ResourceNetwork},
 	// https://docs.docker.com/engine/api/v1.37/#operation/SwarmInit
-	{pattern: "/swarm/init", method: "POST", action: ActionSwarmInit},
+	{pattern: "/swarm/init", method: "POST", action: ActionSwarmInit, resource: ResourceSwarm},
 	// https://docs.docker.com/engine/api/v1.37/#operation/SwarmJoin
-	{pattern: "/swarm/join", method: "POST", action: ActionSwarmJoin},
+	{pattern: "/swarm/join", method: "POST", action: ActionSwarmJoin, resource: ResourceSwarm},
 	// https://docs.docker.com/engine/api/v1.37/#operation/SwarmLeave
-	{pattern: "/swarm/leave", method: "POST", action: ActionSwarmLeave},
+	{pattern: "/swarm/leave", method: "POST", action: ActionSwarmLeave, resource: ResourceSwarm},
 	// https://docs.docker.com/engine/api/v1.37/#operation/SwarmUpdate
-	{pattern: "/swarm/update", method: "POST", action: ActionSwarmUpdate},
+	{pattern: "/swarm/update", method: "POST", action: ActionSwarmUpdate, resource: ResourceSwarm},
 	// https://docs.docker.com/engine/api/v1.37/#operation/SwarmUnlockkey
-	{pattern: "/swarm/unlockkey", method: "GET", action: ActionSwarmUnlockKey},
+	{pattern: "/swarm/unlockkey", method: "GET", action: ActionSwarmUnlockKey, resource: ResourceSwarm},
 	// https://docs.docker.com/engine/api/v1.37/#operation/SwarmUnlock
-	{pattern: "/swarm/unlock", method: "POST", action: ActionSwarmUnlock},
+	{pattern: "/swarm/unlock", method: "POST", action: ActionSwarmUnlock, resource: ResourceSwarm},
 	// https://docs.docker.com/engine/api/v1.37/#operation/SwarmInspect
-	{pattern: "/swarm", method: "GET", action: ActionSwarmInspect},
+	{pattern: "/swarm", method: "GET", action: ActionSwarmInspect, resource: ResourceSwarm},
 	// https://docs.docker.com/engine/api/v1.39/#operation/NodeUpdate
-	{pattern: "/nodes/.+/update", method: "POST", action: ActionNodeUpdate},
+	{pattern: "/nodes/([^/]+)/update", method: "POST", action: ActionNodeUpdate, resource: ResourceNode},
 	// https://docs.docker.com/engine/api/v1.39/#operation/NodeInspect
-	{pattern: "/nodes/.+", method: "GET", action: ActionNodeInspect},
+	{pattern: "/nodes/([^/]+)", method: "GET", action: ActionNodeInspect, resource: ResourceNode},
 	// https://docs.docker.com/engine/api/v1.39/#operation/NodeDelete
-	{pattern: "/nodes/.+", method: "DELETE", action: ActionNodeDelete},
+	{pattern: "/nodes/([^/]+)", method: "DELETE", action: ActionNodeDelete, resource: ResourceNode},
 	// https://docs.docker.com/engine/api/v1.39/#operation/NodeList
-	{pattern: "/nodes", method: "GET", action: ActionNodeList},
+	{pattern: "/nodes", method: "GET", action: ActionNodeList, resource: ResourceNode},
 	// https://docs.docker.com/engine/api/v1.39/#operation/ServiceCreate
-	{pattern: "/services/create", method: "POST", action: ActionServiceCreate},
+	{pattern: "/services/create", method: "POST", action: ActionServiceCreate, resource: ResourceService},
 	// https://docs.docker.com/engine/api/v1.39/#operation/ServiceUpdate
-	{pattern: "/services/.+/update", method: "POST", action: ActionServiceUpdate},
+	{pattern: "/services/([^/]+)/update", method: "POST", action: ActionServiceUpdate, resource: ResourceService},
 	// https://docs.docker.com/engine/api/v1.39/#operation/ServiceLogs
-	{pattern: "/services/.+/logs", method: "GET", action: ActionServiceLogs},
+	{pattern: "/services/([^/]+)/logs", method: "GET", action: ActionServiceLogs, resource: ResourceService},
 	// https://docs.docker.com/engine/api/v1.39/#operation/ServiceInspect
-	{pattern: "/services/.+", method: "GET", action: ActionServiceInspect},
+	{pattern: "/services/([^/]+)", method: "GET", action: ActionServiceInspect, resource: ResourceService},
 	// https://docs.docker.com/engine/api/v1.39/#operation/ServiceDelete
-	{pattern: "/services/.+", method: "DELETE", action: ActionServiceDelete},
+	{pattern: "/services/([^/]+)", method: "DELETE", action: ActionServiceDelete, resource: ResourceService},
 	// https://docs.docker.com/engine/api/v1.39/#operation/ServiceList
-	{pattern: "/services", method: "GET", action: ActionServiceList},
+	{pattern: "/services", method: "GET", action: ActionServiceList, resource: ResourceService},
+	// https://docs.docker.com/engine/api/v1.30/#operation/TaskLogs
+	{pattern: "/tasks/([^/]+)/logs", method: "GET", action: ActionTaskLogs, resource: ResourceTask},
 	// https://docs.docker.com/engine/api/v1.39/#operation/TaskInspect
-	{pattern: "/tasks/.+", method: "GET", action: ActionTaskInspect},
+	{pattern: "/tasks/([^/]+)", method: "GET", action: ActionTaskInspect, resource: ResourceTask},
 	// https://docs.docker.com/engine/api/v1.39/#operation/TaskList
-	{pattern: "/tasks", method: "GET", action: ActionTaskList},
+	{pattern: "/tasks", method: "GET", action: ActionTaskList, resource: ResourceTask},
 	// https://docs.docker.com/engine/api/v1.39/#operation/SecretCreate
-	{pattern: "/secrets/create", method: "POST", action: ActionSecretCreate},
+	{pattern: "/secrets/create", method: "POST", action: ActionSecretCreate, resource: ResourceSecret},
 	// https://docs.docker.com/engine/api/v1.39/#operation/SecretUpdate
-	{pattern: "/secrets/.+/update", method: "POST", action: ActionSecretUpdate},
+	{pattern: "/secrets/([^/]+)/update", method: "POST", action: ActionSecretUpdate, resource: ResourceSecret},
 	// https://docs.docker.com/engine/api/v1.39/#operation/SecretInspect
-	{pattern: "/secrets/.+", method: "GET", action: ActionSecretInspect},
+	{pattern: "/secrets/([^/]+)", method: "GET", action: ActionSecretInspect, resource: ResourceSecret},
 	// https://docs.docker.com/engine/api/v1.39/#operation/SecretDelete
-	{pattern: "/secrets/.+", method: "DELETE", action: ActionSecretDelete},
+	{pattern: "/secrets/([^/]+)", method: "DELETE", action: ActionSecretDelete, resource: ResourceSecret},
 	// https://docs.docker.com/engine/api/v1.39/#operation/SecretList
-	{pattern: "/secrets", method: "GET", action: ActionSecretList},
+	{pattern: "/secrets", method: "GET", action: ActionSecretList, resource: ResourceSecret},
 	// https://docs.docker.com/engine/api/v1.39/#operation/ConfigCreate
-	{pattern: "/configs/create", method: "POST", action: ActionConfigCreate},
+	{pattern: "/configs/create", method: "POST", action: ActionConfigCreate, resource: ResourceConfig},
 	// https://docs.docker.com/engine/api/v1.39/#operation/ConfigUpdate
-	{pattern: "/configs/.+/update", method: "POST", action: ActionConfigUpdate},
+	{pattern: "/configs/([^/]+)/update", method: "POST", action: ActionConfigUpdate, resource: ResourceConfig},
 	// https://docs.docker.com/engine/api/v1.39/#operation/ConfigInspect
-	{pattern: "/configs/.+", method: "GET", action: ActionConfigInspect},
+	{pattern: "/configs/([^/]+)", method: "GET", action: ActionConfigInspect, resource: ResourceConfig},
 	// https://docs.docker.com/engine/api/v1.39/#operation/ConfigDelete
-	{pattern: "/configs/.+", method: "DELETE", action: ActionConfigDelete},
+	{pattern: "/configs/([^/]+)", method: "DELETE", action: ActionConfigDelete, resource: ResourceConfig},
 	// https://docs.docker.com/engine/api/v1.39/#operation/ConfigList
-	{pattern: "/configs", method: "GET", action: ActionConfigList},
+	{pattern: "/configs", method: "GET", action: ActionConfigList, resource: ResourceConfig},
+	// https://docs.docker.com/engine/api/v1.30/#operation/GetPluginPrivileges
+	{pattern: "/plugins/privileges", method: "GET", action: ActionPluginPrivileges, resource: ResourcePlugin},
+	// https://docs.docker.com/engine/api/v1.30/#operation/PluginPull
+	{pattern: "/plugins/pull", method: "POST", action: ActionPluginInstall, resource: ResourcePlugin},
+	// https://docs.docker.com/engine/api/v1.30/#operation/PluginCreate
+	{pattern: "/plugins/create", method: "POST", action: ActionPluginCreate, resource: ResourcePlugin},
+	// https://docs.docker.com/engine/api/v1.30/#operation/PluginInspect
+	{pattern: "/plugins/(.+)/json", method: "GET", action: ActionPluginInspect, resource: ResourcePlugin},
+	// https://docs.docker.com/engine/api/v1.30/#operation/PluginEnable
+	{pattern: "/plugins/(.+)/enable", method: "POST", action: ActionPluginEnable, resource: ResourcePlugin},
+	// https://docs.docker.com/engine/api/v1.30/#operation/PluginDisable
+	{pattern: "/plugins/(.+)/disable", method: "POST", action: ActionPluginDisable, resource: ResourcePlugin},
+	// https://docs.docker.com/engine/api/v1.30/#operation/PluginUpgrade
+	{pattern: "/plugins/(.+)/upgrade", method: "POST", action: ActionPluginUpgrade, resource: ResourcePlugin},
+	// https://docs.docker.com/engine/api/v1.30/#operation/PluginPush
+	{pattern: "/plugins/(.+)/push", method: "POST", action: ActionPluginPush, resource: ResourcePlugin},
+	// https://docs.docker.com/engine/api/v1.30/#operation/PluginSet
+	{pattern: "/plugins/(.+)/set", method: "POST", action: ActionPluginSet, resource: ResourcePlugin},
+	// https://docs.docker.com/engine/api/v1.30/#operation/PluginDelete
+	{pattern: "/plugins/(.+)", method: "DELETE", action: ActionPluginDelete, resource: ResourcePlugin},
+	// https://docs.docker.com/engine/api/v1.30/#operation/PluginList
+	{pattern: "/plugins", method: "GET", action: ActionPluginList, resource: ResourcePlugin},
 	// https://docs.docker.com/engine/api/v1.39/#operation/DistributionInspect
-	{pattern: "/distribution/.+/json", method: "GET", action: ActionDistributionInspect},
+	{pattern: "/distribution/(.+)/json", method: "GET", action: ActionDistributionInspect, resource: ResourceImage},
 }
 
-// ParseRoute convert a method/url pattern to corresponding docker action
-func ParseRoute(method, url string) string {
-	for _, route := range routes {
-		if route.method == method {
-			match, err := regexp.MatchString(route.pattern, url)
-			if err == nil && match {
-				return route.action
+// compiledRoute is a route with its precompiled anchored pattern
+type compiledRoute struct {
+	*route
+	re          *regexp.Regexp
+	specificity int // specificity is the number of literal characters in the pattern
+}
+
+// routeMatcher matches request paths against the routes, ordered from the most specific route to the least specific
+type routeMatcher []compiledRoute
+
+// capturePattern matches the capture groups of a route pattern
+var capturePattern = regexp.MustCompile(`\([^)]*\)`)
+
+// matcher is the route matcher of the docker API routes
+var matcher = newRouteMatcher(routes)
+
+// newRouteMatcher compiles the routes patterns, anchored to the full path.
+// When several routes match the same path, the route with the most literal characters wins, regardless of the routes order
+func newRouteMatcher(routes []route) routeMatcher {
+	matcher := make(routeMatcher, len(routes))
+	for i := range routes {
+		matcher[i] = compiledRoute{
+			route:       &routes[i],
+			re:          regexp.MustCompile("^" + routes[i].pattern + "$"),
+			specificity: len(capturePattern.ReplaceAllString(routes[i].pattern, "")),
+		}
+	}
+	sort.SliceStable(matcher, func(i, j int) bool {
+		return matcher[i].specificity > matcher[j].specificity
+	})
+	return matcher
+}
+
+// match returns the most specific route available in the API version that matches the given method and path
+// (API version prefix removed), and the captured resource id
+func (m routeMatcher) match(method, path, version string) (*route, string) {
+	for _, route := range m {
+		if route.method != method {
+			continue
+		}
+		if route.maxVersion != "" && APIVersionGreaterThan(version, route.maxVersion) {
+			continue
+		}
+		if match := route.re.FindStringSubmatch(path); match != nil {
+			var id string
+			if len(match) > 1 {
+				id = match[1]
 			}
+			return route.route, id
+		}
+	}
+	return nil, ""
+}
 
+// Actions returns the docker actions the API routes are mapped to, in sorted order
+func Actions() []string {
+	seen := make(map[string]bool)
+	var actions []string
+	for _, route := range routes {
+		if !seen[route.action] {
+			seen[route.action] = true
+			actions = append(actions, route.action)
 		}
 	}
+	sort.Strings(actions)
+	return actions
+}
+
+// Resources returns the kinds of objects the API routes refer to (e.g., container), in sorted order
+func Resources() []string {
+	seen := make(map[string]bool)
+	var resources []string
+	for _, route := range routes {
+		if route.resource != ResourceNone && !seen[route.resource] {
+			seen[route.resource] = true
+			resources = append(resources, route.resource)
+		}
+	}
+	sort.Strings(resources)
+	return resources
+}
+
+// ParseRoute convert a method/url pattern to corresponding docker action
+func ParseRoute(method, url string) string {
+	info, err := ParseRequest(method, url)
+	if err != nil {
+		return ActionNone
+	}
+	return info.Action
+}
 
-	return ActionNone
+// ParseRequest parses the method and the full request URI (path and query) sent to docker daemon
+// into the docker action and the object the request refers to
+func ParseRequest(method, uri string) (*RouteInfo, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &RouteInfo{Action: ActionNone, Query: u.Query()}
+	path := u.Path
+	if match := versionPattern.FindStringSubmatch(path); match != nil {
+		info.APIVersion = match[1]
+		// Keep the slash that separates the version prefix from the route path
+		path = path[len(match[0])-1:]
+	}
+
+	route, id := matcher.match(method, path, info.APIVersion)
+	if route != nil {
+		info.Action = route.action
+		info.Resource = route.resource
+		info.ResourceID = id
+	}
+	return info, nil
 }
@@ -1,11 +1,38 @@
 package core
 
 import (
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
 )
 
+// swaggerPath is the API specification of the vendored docker engine
+const swaggerPath = "../vendor/github.com/docker/docker/api/swagger.yaml"
+
+// newerEndpoints are the endpoints added in API versions newer than the vendored API specification
+var newerEndpoints = []struct {
+	method string
+	path   string
+}{
+	{"POST", "/build/prune"},             // API 1.31
+	{"POST", "/build/cancel"},            // API 1.38
+	{"POST", "/session"},                 // API 1.31
+	{"POST", "/grpc"},                    // API 1.31
+	{"GET", "/configs"},                  // API 1.30
+	{"POST", "/configs/create"},          // API 1.30
+	{"GET", "/configs/{id}"},             // API 1.30
+	{"DELETE", "/configs/{id}"},          // API 1.30
+	{"POST", "/configs/{id}/update"},     // API 1.30
+	{"GET", "/distribution/{name}/json"}, // API 1.30
+	{"HEAD", "/_ping"},                   // API 1.40
+	{"PUT", "/volumes/{name}"},           // API 1.42
+}
+
 func TestRouteParser(t *testing.T) {
 
 	tests := []struct {
@@ -47,7 +74,6 @@ func TestRouteParser(t *testing.T) {
 		{"POST", "/v1.21/images/create", ActionImageCreate},
 		{"POST", "/v1.21/images/load", ActionImageLoad},
 		{"GET", "/v1.21/images/json", ActionImageList},
-		{"POST", "/v1.21/images/build", ActionImageBuild},
 		{"GET", "/v1.21/images/id/json", ActionImageInspect},
 		{"DELETE", "/v1.21/images/id", ActionImageDelete},
 		{"POST", "/v1.37/images/prune", ActionImagePrune},
@@ -93,9 +119,232 @@ func TestRouteParser(t *testing.T) {
 		{"DELETE", "/v1.39/configs/id", ActionConfigDelete},
 		{"POST", "/v1.39/configs/id/update", ActionConfigUpdate},
 		{"GET", "/v1.39/distribution/twistlock/authz-broker:latest/json", ActionDistributionInspect},
+		{"GET", "/v1.30/containers/id/export", ActionContainerExport},
+		{"POST", "/v1.30/containers/id/update", ActionContainerUpdate},
+		{"POST", "/v1.30/containers/prune", ActionContainerPrune},
+		{"POST", "/v1.30/exec/id/resize", ActionContainerExecResize},
+		{"GET", "/v1.30/images/get", ActionImageArchive},
+		{"POST", "/v1.39/build/prune", ActionImageBuildPrune},
+		{"POST", "/v1.39/build/cancel?id=x", ActionImageBuildCancel},
+		{"POST", "/v1.39/session", ActionImageBuildSession},
+		{"POST", "/v1.39/grpc", ActionImageBuildGRPC},
+		{"GET", "/v1.30/events", ActionDockerEvents},
+		{"GET", "/v1.30/system/df", ActionDockerDiskUsage},
+		{"HEAD", "/v1.40/_ping", ActionDockerPing},
+		{"POST", "/v1.30/volumes/prune", ActionVolumePrune},
+		{"PUT", "/v1.42/volumes/id", ActionVolumeUpdate},
+		{"POST", "/v1.30/networks/prune", ActionNetworkPrune},
+		{"GET", "/v1.30/tasks/id/logs", ActionTaskLogs},
+		{"GET", "/v1.30/plugins", ActionPluginList},
+		{"GET", "/v1.30/plugins/privileges", ActionPluginPrivileges},
+		{"POST", "/v1.30/plugins/pull", ActionPluginInstall},
+		{"POST", "/v1.30/plugins/create", ActionPluginCreate},
+		{"GET", "/v1.30/plugins/id/json", ActionPluginInspect},
+		{"DELETE", "/v1.30/plugins/id", ActionPluginDelete},
+		{"POST", "/v1.30/plugins/id/enable", ActionPluginEnable},
+		{"POST", "/v1.30/plugins/id/disable", ActionPluginDisable},
+		{"POST", "/v1.30/plugins/id/upgrade", ActionPluginUpgrade},
+		{"POST", "/v1.30/plugins/id/push", ActionPluginPush},
+		{"POST", "/v1.30/plugins/id/set", ActionPluginSet},
+		{"GET", "/v1.39/configs", ActionConfigList},
 	}
 
 	for _, test := range tests {
 		assert.Equal(t, test.expectedAction, ParseRoute(test.method, test.url))
 	}
 }
+
+func TestRouteParserAdversarial(t *testing.T) {
+
+	tests := []struct {
+		method         string
+		url            string
+		expectedAction string
+	}{
+		{"GET", "/v1.40/containers/x/json?/start", ActionContainerInspect},                     // Query is not part of the path
+		{"POST", "/v1.40/containers/x/json?/start", ActionNone},                                // Inspect path with start in the query
+		{"GET", "/v1.40/containers/version", ActionNone},                                       // Unanchored /version
+		{"GET", "/v1.40/info/version", ActionNone},                                             // Unanchored /version
+		{"GET", "/versions", ActionNone},                                                       // Unanchored /version
+		{"DELETE", "/v1.40/containers/x/start", ActionNone},                                    // Container delete with a nested path
+		{"DELETE", "/v1.40/volumes/x/y", ActionNone},                                           // Volume delete with a nested path
+		{"POST", "/v1.40/containers//kill", ActionNone},                                        // Empty container id
+		{"POST", "/v1.40/containers/x%2Fy/start", ActionNone},                                  // Encoded slash in container id
+		{"GET", "/v1.40/containers/json/", ActionNone},                                         // Trailing slash
+		{"POST", "/v1.21/images/build", ActionNone},                                            // Unanchored /build
+		{"POST", "/v1.40/images/x/build/push", ActionImagePush},                                // Image name containing build
+		{"GET", "/v1.40/images/registry.local/version/json", ActionImageInspect},               // Image name containing version
+		{"GET", "/v1.40/v1.40/containers/json", ActionNone},                                    // Repeated version prefix
+		{"GET", "/v1.40containers/json", ActionNone},                                           // Malformed version prefix
+		{"POST", "/v1.40./containers/x/exec", ActionContainerExecCreate},                       // Trailing dot in version, served by docker
+		{"POST", "/v1.40./swarm/leave", ActionSwarmLeave},                                      // Trailing dot in version, served by docker
+		{"POST", "/v1.40./containers/create", ActionContainerCreate},                           // Trailing dot in version, served by docker
+		{"GET", "/v1..40/containers/json", ActionContainerList},                                // Repeated dot in version, served by docker
+		{"GET", "/prefix/v1.40/containers/json", ActionNone},                                   // Prefixed path
+		{"get", "/v1.40/containers/json", ActionNone},                                          // Method is case sensitive
+		{"PUT", "/v1.40/containers/x/start", ActionNone},                                       // Method mismatch
+		{"POST", "/containers/x/start", ActionContainerStart},                                  // No version prefix
+		{"POST", "/v1.40/build/prune", ActionImageBuildPrune},                                  // Build prune, not build
+		{"GET", "/v1.40/images/get", ActionImageArchive},                                       // All images archive, not image named get
+		{"GET", "/v1.40/plugins/vieux/sshfs:latest/json", ActionPluginInspect},                 // Plugin name containing slash
+		{"DELETE", "/v1.40/plugins/vieux/sshfs:latest", ActionPluginDelete},                    // Plugin name containing slash
+		{"GET", "/v1.40/distribution/registry.local/app/json/json", ActionDistributionInspect}, // Image name containing json
+		{"POST", "/v1.23/containers/x/copy", ActionContainerCopyFiles},                         // Copy is available up to 1.23
+		{"POST", "/v1.9/containers/x/copy", ActionContainerCopyFiles},                          // Versions are compared numerically
+		{"POST", "/v1.24/containers/x/copy", ActionNone},                                       // Copy is removed in 1.24
+		{"POST", "/containers/x/copy", ActionNone},                                             // No version is the latest version
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expectedAction, ParseRoute(test.method, test.url), "%s %s", test.method, test.url)
+	}
+}
+
+func TestRouteMatcherSpecificity(t *testing.T) {
+
+	tests := []struct {
+		method         string
+		path           string
+		expectedAction string
+	}{
+		{"GET", "/images/get", ActionImageArchive},
+		{"GET", "/images/json", ActionImageList},
+		{"GET", "/images/search", ActionImagesSearch},
+		{"GET", "/plugins/privileges", ActionPluginPrivileges},
+		{"POST", "/plugins/pull", ActionPluginInstall},
+		{"POST", "/build/prune", ActionImageBuildPrune},
+		{"POST", "/build/cancel", ActionImageBuildCancel},
+		{"GET", "/containers/json", ActionContainerList},
+		{"POST", "/containers/prune", ActionContainerPrune},
+		{"GET", "/swarm/unlockkey", ActionSwarmUnlockKey},
+	}
+
+	// Routes order must not affect the matched route
+	reversed := make([]route, len(routes))
+	for i := range routes {
+		reversed[len(routes)-1-i] = routes[i]
+	}
+	for _, m := range []routeMatcher{newRouteMatcher(routes), newRouteMatcher(reversed)} {
+		for _, test := range tests {
+			route, _ := m.match(test.method, test.path, "")
+			if assert.NotNil(t, route, test.path) {
+				assert.Equal(t, test.expectedAction, route.action, test.path)
+			}
+		}
+	}
+
+	// A parametrized route must not shadow a more specific literal route, even if it is listed first
+	m := newRouteMatcher([]route{
+		{pattern: "/images/(.+)", method: "GET", action: ActionImageInspect, resource: ResourceImage},
+		{pattern: "/images/json", method: "GET", action: ActionImageList, resource: ResourceImage},
+	})
+	route, id := m.match("GET", "/images/json", "")
+	if assert.NotNil(t, route) {
+		assert.Equal(t, ActionImageList, route.action)
+		assert.Empty(t, id)
+	}
+	route, id = m.match("GET", "/images/busybox", "")
+	if assert.NotNil(t, route) {
+		assert.Equal(t, ActionImageInspect, route.action)
+		assert.Equal(t, "busybox", id)
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+
+	tests := []struct {
+		method             string
+		uri                string
+		expectedAction     string
+		expectedResource   string
+		expectedResourceID string
+		expectedVersion    string
+		expectedQuery      map[string]string
+	}{
+		{"POST", "/v1.21/containers/web-1/start", ActionContainerStart, ResourceContainer, "web-1", "1.21", nil},
+		{"DELETE", "/v1.39/containers/web-1?force=1&v=1", ActionContainerDelete, ResourceContainer, "web-1", "1.39", map[string]string{"force": "1", "v": "1"}},
+		{"POST", "/v1.21/containers/create?name=web-1", ActionContainerCreate, ResourceContainer, "", "1.21", map[string]string{"name": "web-1"}},
+		{"GET", "/v1.21/containers/json?all=1", ActionContainerList, ResourceContainer, "", "1.21", map[string]string{"all": "1"}},
+		{"POST", "/v1.21/images/registry.local/ci/app/tag?repo=app&tag=v1", ActionImageTag, ResourceImage, "registry.local/ci/app", "1.21", map[string]string{"repo": "app", "tag": "v1"}},
+		{"DELETE", "/v1.21/images/registry.local:5000/ci/app:v1", ActionImageDelete, ResourceImage, "registry.local:5000/ci/app:v1", "1.21", nil},
+		{"GET", "/v1.21/volumes/data", ActionVolumeInspect, ResourceVolume, "data", "1.21", nil},
+		{"POST", "/v1.21/networks/backend/connect", ActionNetworkConnect, ResourceNetwork, "backend", "1.21", nil},
+		{"POST", "/v1.21/exec/123/start", ActionContainerExecStart, ResourceExec, "123", "1.21", nil},
+		{"DELETE", "/v1.39/secrets/db-password", ActionSecretDelete, ResourceSecret, "db-password", "1.39", nil},
+		{"POST", "/v1.39/services/api/update?version=12", ActionServiceUpdate, ResourceService, "api", "1.39", map[string]string{"version": "12"}},
+		{"GET", "/version", ActionDockerVersion, ResourceNone, "", "", nil},
+		{"GET", "/v1.21/images/non_existing", ActionNone, ResourceNone, "", "1.21", nil},
+	}
+
+	for _, test := range tests {
+		route, err := ParseRequest(test.method, test.uri)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expectedAction, route.Action, test.uri)
+		assert.Equal(t, test.expectedResource, route.Resource, test.uri)
+		assert.Equal(t, test.expectedResourceID, route.ResourceID, test.uri)
+		assert.Equal(t, test.expectedVersion, route.APIVersion, test.uri)
+		for k, v := range test.expectedQuery {
+			assert.Equal(t, v, route.Query.Get(k), test.uri)
+		}
+	}
+
+	_, err := ParseRequest("GET", "/v1.21/containers/%zz/json")
+	assert.Error(t, err, "Invalid URI must not be parsed")
+}
+
+// TestRouteTableCoverage verifies every endpoint of the docker engine API is mapped to an action,
+// so endpoints added when the vendored engine is updated are not silently left without authorization
+func TestRouteTableCoverage(t *testing.T) {
+	data, err := ioutil.ReadFile(swaggerPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var spec struct {
+		Paths map[string]map[string]interface{} `yaml:"paths"`
+	}
+	if !assert.NoError(t, yaml.Unmarshal(data, &spec)) {
+		return
+	}
+	assert.NotEmpty(t, spec.Paths, "API specification must contain paths")
+
+	endpoints := newerEndpoints
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			if method == "parameters" {
+				continue
+			}
+			endpoints = append(endpoints, struct {
+				method string
+				path   string
+			}{strings.ToUpper(method), path})
+		}
+	}
+
+	parameter := regexp.MustCompile(`\{[^}]+\}`)
+	for _, endpoint := range endpoints {
+		url := "/v1.30" + parameter.ReplaceAllString(endpoint.path, "id")
+		assert.NotEqual(t, ActionNone, ParseRoute(endpoint.method, url), "Endpoint %s %s must be mapped to an action", endpoint.method, endpoint.path)
+	}
+}
+
+func TestResources(t *testing.T) {
+	resources := Resources()
+	assert.True(t, sort.StringsAreSorted(resources), "Resources must be sorted")
+	assert.Equal(t, []string{ResourceConfig, ResourceContainer, ResourceExec, ResourceImage, ResourceNetwork, ResourceNode,
+		ResourcePlugin, ResourceSecret, ResourceService, ResourceSwarm, ResourceTask, ResourceVolume}, resources)
+}
+
+func TestActions(t *testing.T) {
+	actions := Actions()
+	assert.True(t, sort.StringsAreSorted(actions), "Actions must be sorted")
+	assert.Contains(t, actions, ActionContainerCreate)
+	assert.Contains(t, actions, ActionDockerPing)
+	assert.NotContains(t, actions, ActionNone)
+
+	seen := make(map[string]bool)
+	for _, action := range actions {
+		assert.False(t, seen[action], "Action %s must be listed once", action)
+		seen[action] = true
+	}
+}
@@ -21,22 +21,34 @@ const (
 // AuthZSrv implements the authz plugin specification on top of unix sockets
 // the authZSrv uses two core components to manage the flow, the authorizer,
 // which is used to perform the actual authorization and the auditor, which
-// is used to audit the authorization flow
+// is used to audit the authorization flow.
+// In monitor mode, all requests are allowed and the authorizer decisions are only audited
 type AuthZSrv struct {
 	authorizer Authorizer   // authorizer is the concrete handler for plugins
 	auditor    Auditor      // auditor is used to audit input/output
+	mode       string       // mode is the enforcement mode (enforce or monitor)
 	listener   net.Listener // listener is the plugin socket listener
 }
 
-// NewAuthZSrv creates a new authorization server
+// NewAuthZSrv creates a new authorization server in enforce mode
 func NewAuthZSrv(plugin Authorizer, auditor Auditor) *AuthZSrv {
-	return &AuthZSrv{authorizer: plugin, auditor: auditor}
+	return NewAuthZSrvWithMode(plugin, auditor, ModeEnforce)
+}
+
+// NewAuthZSrvWithMode creates a new authorization server, the mode is either enforce (default if empty) or monitor
+func NewAuthZSrvWithMode(plugin Authorizer, auditor Auditor, mode string) *AuthZSrv {
+	return &AuthZSrv{authorizer: plugin, auditor: auditor, mode: mode}
 }
 
 // Start starts the authorization server
 func (a *AuthZSrv) Start() error {
 
-	err := a.authorizer.Init()
+	err := ValidateMode(a.mode)
+	if err != nil {
+		return err
+	}
+
+	err = a.authorizer.Init()
 
 	if err != nil {
 		return err
@@ -89,9 +101,12 @@ func (a *AuthZSrv) Start() error {
 		}
 
 		authZRes := a.authorizer.AuthZReq(&authReq)
+		if a.mode == ModeMonitor {
+			authZRes = MonitorResponse(authZRes)
+		}
 
 		if authZRes != nil {
-			logrus.Debugf(authZRes.Msg)
+			logrus.Debug(authZRes.Msg)
 		}
 
 		err = a.auditor.AuditRequest(&authReq, authZRes)
@@ -121,6 +136,9 @@ func (a *AuthZSrv) Start() error {
 		}
 
 		authZRes := a.authorizer.AuthZRes(&authReq)
+		if a.mode == ModeMonitor {
+			authZRes = MonitorResponse(authZRes)
+		}
 		err = a.auditor.AuditResponse(&authReq, authZRes)
 		if err != nil {
 			logrus.Errorf("Failed to audit response '%v'", err)
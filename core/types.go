@@ -27,6 +27,8 @@ var (
 	ActionContainerExecInspect = "container_exec_inspect"
 	// ActionContainerExecStart describes https://docs.docker.com/reference/api/docker_remote_api_v1.21/#exec-start
 	ActionContainerExecStart = "container_exec_start"
+	// ActionContainerExecResize describes https://docs.docker.com/engine/api/v1.30/#operation/ExecResize
+	ActionContainerExecResize = "container_exec_resize"
 	// ActionContainerExport describes http://docs.docker.com/reference/api/docker_remote_api_v1.21/#export-a-container
 	ActionContainerExport = "container_export"
 	// ActionContainerInspect describes https://docs.docker.com/reference/api/docker_remote_api_v1.21/#inspect-a-container
@@ -39,6 +41,8 @@ var (
 	ActionContainerLogs = "container_logs"
 	// ActionContainerPause describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#pause-a-container
 	ActionContainerPause = "container_pause"
+	// ActionContainerPrune describes https://docs.docker.com/engine/api/v1.30/#operation/ContainerPrune
+	ActionContainerPrune = "container_prune"
 	// ActionContainerRename describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#rename-a-container
 	ActionContainerRename = "container_rename"
 	// ActionContainerResize describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#resize-a-container-tty
@@ -55,10 +59,14 @@ var (
 	ActionContainerTop = "container_top"
 	// ActionContainerUnpause describes http://docs.docker.com/reference/api/docker_remote_api_v1.21/#unpause-a-container
 	ActionContainerUnpause = "container_unpause"
+	// ActionContainerUpdate describes https://docs.docker.com/engine/api/v1.30/#operation/ContainerUpdate
+	ActionContainerUpdate = "container_update"
 	// ActionContainerWait describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#wait-a-container
 	ActionContainerWait = "container_wait"
 	// ActionDockerCheckAuth describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#check-auth-configuration
 	ActionDockerCheckAuth = "docker_auth"
+	// ActionDockerDiskUsage describes https://docs.docker.com/engine/api/v1.30/#operation/SystemDataUsage
+	ActionDockerDiskUsage = "docker_disk_usage"
 	// ActionDockerEvents describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#monitor-docker-s-events
 	ActionDockerEvents = "docker_events"
 	// ActionDockerInfo describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#display-system-wide-information
@@ -71,6 +79,14 @@ var (
 	ActionImageArchive = "images_archive"
 	// ActionImageBuild describes https://docs.docker.com/reference/api/docker_remote_api_v1.21/#build-image-from-a-dockerfile
 	ActionImageBuild = "image_build"
+	// ActionImageBuildPrune describes https://docs.docker.com/engine/api/v1.39/#operation/BuildPrune
+	ActionImageBuildPrune = "image_build_prune"
+	// ActionImageBuildCancel describes the cancellation of a running BuildKit build (API 1.38 and above)
+	ActionImageBuildCancel = "image_build_cancel"
+	// ActionImageBuildSession describes the interactive session of BuildKit builds (https://docs.docker.com/engine/api/v1.39/#operation/Session)
+	ActionImageBuildSession = "image_build_session"
+	// ActionImageBuildGRPC describes the gRPC endpoint of BuildKit builds
+	ActionImageBuildGRPC = "image_build_grpc"
 	// ActionImageCreate describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#create-an-image
 	ActionImageCreate = "image_create"
 	// ActionImageDelete describes https://docs.docker.com/reference/api/docker_remote_api_v1.18/#inspect-an-image
@@ -99,6 +115,10 @@ var (
 	ActionVolumeInspect = "volume_inspect"
 	// ActionVolumeRemove describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#remove-a-volume
 	ActionVolumeRemove = "volume_remove"
+	// ActionVolumeUpdate describes https://docs.docker.com/engine/api/v1.42/#operation/VolumeUpdate
+	ActionVolumeUpdate = "volume_update"
+	// ActionVolumePrune describes https://docs.docker.com/engine/api/v1.30/#operation/VolumePrune
+	ActionVolumePrune = "volume_prune"
 	// ActionNetworkList describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#list-networks
 	ActionNetworkList = "network_list"
 	// ActionNetworkInspect describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#inspect-network
@@ -112,6 +132,8 @@ var (
 	ActionNetworkDisconnect = "network_disconnect"
 	// ActionNetworkRemove describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#remove-a-network
 	ActionNetworkRemove = "network_remove"
+	// ActionNetworkPrune describes https://docs.docker.com/engine/api/v1.30/#operation/NetworkPrune
+	ActionNetworkPrune = "network_prune"
 	// ActionSwarmInspect describes https://docs.docker.com/engine/api/v1.37/#operation/SwarmInspect
 	ActionSwarmInspect = "swarm_inspect"
 	// ActionSwarmInit describes https://docs.docker.com/engine/api/v1.37/#operation/SwarmInit
@@ -150,6 +172,8 @@ var (
 	ActionTaskList = "task_list"
 	// ActionTaskInspect describes https://docs.docker.com/engine/api/v1.39/#operation/TaskInspect
 	ActionTaskInspect = "task_inspect"
+	// ActionTaskLogs describes https://docs.docker.com/engine/api/v1.30/#operation/TaskLogs
+	ActionTaskLogs = "task_logs"
 	// ActionSecretList describes https://docs.docker.com/engine/api/v1.39/#operation/SecretList
 	ActionSecretList = "secret_list"
 	// ActionSecretCreate describes https://docs.docker.com/engine/api/v1.39/#operation/SecretCreate
@@ -170,8 +194,59 @@ var (
 	ActionConfigDelete = "config_delete"
 	// ActionConfigUpdate describes https://docs.docker.com/engine/api/v1.39/#operation/ConfigUpdate
 	ActionConfigUpdate = "config_update"
+	// ActionPluginList describes https://docs.docker.com/engine/api/v1.30/#operation/PluginList
+	ActionPluginList = "plugin_list"
+	// ActionPluginPrivileges describes https://docs.docker.com/engine/api/v1.30/#operation/GetPluginPrivileges
+	ActionPluginPrivileges = "plugin_privileges"
+	// ActionPluginInstall describes https://docs.docker.com/engine/api/v1.30/#operation/PluginPull
+	ActionPluginInstall = "plugin_install"
+	// ActionPluginInspect describes https://docs.docker.com/engine/api/v1.30/#operation/PluginInspect
+	ActionPluginInspect = "plugin_inspect"
+	// ActionPluginDelete describes https://docs.docker.com/engine/api/v1.30/#operation/PluginDelete
+	ActionPluginDelete = "plugin_delete"
+	// ActionPluginEnable describes https://docs.docker.com/engine/api/v1.30/#operation/PluginEnable
+	ActionPluginEnable = "plugin_enable"
+	// ActionPluginDisable describes https://docs.docker.com/engine/api/v1.30/#operation/PluginDisable
+	ActionPluginDisable = "plugin_disable"
+	// ActionPluginUpgrade describes https://docs.docker.com/engine/api/v1.30/#operation/PluginUpgrade
+	ActionPluginUpgrade = "plugin_upgrade"
+	// ActionPluginCreate describes https://docs.docker.com/engine/api/v1.30/#operation/PluginCreate
+	ActionPluginCreate = "plugin_create"
+	// ActionPluginPush describes https://docs.docker.com/engine/api/v1.30/#operation/PluginPush
+	ActionPluginPush = "plugin_push"
+	// ActionPluginSet describes https://docs.docker.com/engine/api/v1.30/#operation/PluginSet
+	ActionPluginSet = "plugin_set"
 	// ActionDistributionInspect describes https://docs.docker.com/engine/api/v1.39/#operation/DistributionInspect
 	ActionDistributionInspect = "distribution_inspect"
 	// ActionNone indicates no action matched the given method URL combination
 	ActionNone = ""
 )
+
+var (
+	// ResourceContainer indicates the request refers to a container
+	ResourceContainer = "container"
+	// ResourceExec indicates the request refers to an exec instance
+	ResourceExec = "exec"
+	// ResourceImage indicates the request refers to an image
+	ResourceImage = "image"
+	// ResourceVolume indicates the request refers to a volume
+	ResourceVolume = "volume"
+	// ResourceNetwork indicates the request refers to a network
+	ResourceNetwork = "network"
+	// ResourceSwarm indicates the request refers to the swarm
+	ResourceSwarm = "swarm"
+	// ResourceNode indicates the request refers to a swarm node
+	ResourceNode = "node"
+	// ResourceService indicates the request refers to a swarm service
+	ResourceService = "service"
+	// ResourceTask indicates the request refers to a swarm task
+	ResourceTask = "task"
+	// ResourceSecret indicates the request refers to a swarm secret
+	ResourceSecret = "secret"
+	// ResourceConfig indicates the request refers to a swarm config
+	ResourceConfig = "config"
+	// ResourcePlugin indicates the request refers to a managed plugin
+	ResourcePlugin = "plugin"
+	// ResourceNone indicates the request does not refer to a specific object type (e.g., docker version)
+	ResourceNone = ""
+)
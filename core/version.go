@@ -0,0 +1,30 @@
+package core
+
+import (
+	"fmt"
+	"github.com/docker/docker/api/types/versions"
+	"regexp"
+)
+
+// apiVersionPattern matches a docker API version (e.g., 1.40)
+var apiVersionPattern = regexp.MustCompile(`^[0-9]+(?:\.[0-9]+)*$`)
+
+// ValidateAPIVersion checks whether the version is a valid docker API version (e.g., 1.40)
+func ValidateAPIVersion(version string) error {
+	if !apiVersionPattern.MatchString(version) {
+		return fmt.Errorf("invalid API version '%s'", version)
+	}
+	return nil
+}
+
+// APIVersionLessThan checks whether the request API version is lower than the given version.
+// Requests without API version are served in the daemon default version, which is the latest version
+func APIVersionLessThan(version, other string) bool {
+	return version != "" && versions.LessThan(version, other)
+}
+
+// APIVersionGreaterThan checks whether the request API version is greater than the given version.
+// Requests without API version are served in the daemon default version, which is the latest version
+func APIVersionGreaterThan(version, other string) bool {
+	return version == "" || versions.GreaterThan(version, other)
+}
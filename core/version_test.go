@@ -0,0 +1,24 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIVersion(t *testing.T) {
+
+	assert.NoError(t, ValidateAPIVersion("1.40"))
+	assert.NoError(t, ValidateAPIVersion("1"))
+	assert.Error(t, ValidateAPIVersion(""))
+	assert.Error(t, ValidateAPIVersion("v1.40"))
+	assert.Error(t, ValidateAPIVersion("1..40"))
+
+	assert.True(t, APIVersionLessThan("1.9", "1.24"), "Versions must be compared numerically")
+	assert.False(t, APIVersionLessThan("1.24", "1.24"))
+	assert.False(t, APIVersionLessThan("", "1.24"), "Requests without version use the latest version")
+
+	assert.True(t, APIVersionGreaterThan("1.40", "1.24"))
+	assert.False(t, APIVersionGreaterThan("1.24", "1.24"))
+	assert.True(t, APIVersionGreaterThan("", "1.24"), "Requests without version use the latest version")
+}